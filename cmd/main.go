@@ -1,24 +1,79 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 
+	"jira-discord-webhook/internal/auth"
+	"jira-discord-webhook/internal/config"
+	"jira-discord-webhook/internal/dedup"
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/filter"
 	"jira-discord-webhook/internal/handler"
+	"jira-discord-webhook/internal/jira"
+	"jira-discord-webhook/internal/metrics"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/reload"
+	"jira-discord-webhook/internal/routing"
+	"jira-discord-webhook/internal/store"
 	"jira-discord-webhook/internal/utils"
 )
 
+// Command-line flags. The configuration file can also be named by
+// CONFIG_PATH.
+var (
+	configPath  = flag.String("config", "", "YAML configuration `file` (default $CONFIG_PATH)")
+	printConfig = flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...
+// -X main.buildTime=...".
+var (
+	version   = "dev"
+	commit    string
+	buildTime string
+)
+
 func main() {
 	_ = godotenv.Load()
+	// go test parses the flags before running main.
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("CONFIG_PATH")
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("failed to print configuration: %v", err)
+		}
+		return
+	}
 
-	logLevel := os.Getenv("LOG_LEVEL")
 	var level zap.AtomicLevel
-	switch logLevel {
+	switch cfg.Server.LogLevel {
 	case "debug":
 		level = zap.NewAtomicLevelAt(zap.DebugLevel)
 	case "info":
@@ -53,17 +108,215 @@ func main() {
 		TimeFormat: "2006-01-02 15:04:05",
 		Output:     accessRotateWriter,
 	}))
-	app.Post("/webhook", handler.WebhookHandler)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	authConfig := cfg.Auth.Config()
+	if !authConfig.Enabled() {
+		zapLogger.Warn("webhook authentication disabled; set WEBHOOK_SECRET, WEBHOOK_TOKEN or WEBHOOK_ALLOWED_IPS")
 	}
-	userMappingPath := os.Getenv("USER_MAPPING_PATH")
-	if userMappingPath == "" {
-		userMappingPath = "config/user_mapping.yaml"
+	authMiddleware, err := auth.New(authConfig)
+	if err != nil {
+		log.Fatalf("failed to configure webhook authentication: %v", err)
 	}
-	if err := utils.LoadUserMapping(userMappingPath); err != nil {
+	notifier := discord.NewClient()
+	notifier.WebhookURL = cfg.Discord.WebhookURL
+	notifier.HTTPClient.Timeout = cfg.Discord.Timeout
+	var active activeConfig
+	configs := reload.New()
+	if err := configs.Load("user mapping", cfg.Files.UserMapping, active.loadUsers); err != nil {
 		log.Fatalf("failed to load user mapping: %v", err)
 	}
-	log.Fatal(app.Listen(":" + port))
+	if paths := nonEmpty(cfg.Files.Templates, cfg.Files.Routes); len(paths) > 0 {
+		load := func() error { return active.loadRouting(cfg.Files.Templates, cfg.Files.Routes) }
+		if err := configs.LoadGroup("templates and routes", paths, load); err != nil {
+			log.Fatalf("failed to load templates and routes: %v", err)
+		}
+	}
+	if filtersPath := cfg.Files.Filters; filtersPath != "" {
+		if err := configs.Load("filters", filtersPath, active.loadFilters); err != nil {
+			log.Fatalf("failed to load filters: %v", err)
+		}
+	}
+	if err := configs.Start(); err != nil {
+		zapLogger.Warn("config files are not watched; send SIGHUP to reload", zap.Error(err))
+	}
+	defer configs.Stop()
+
+	webhooks := handler.NewWebhookHandler(notifier, jira.RenderMessage, handler.Settings{
+		BaseURL:   cfg.Jira.BaseURL,
+		Colors:    cfg.Colors.Jira(),
+		Routes:    active.routes.Load,
+		Filters:   active.filters.Load,
+		Templates: active.templates.Load,
+		Users:     active.users.Load,
+		Build:     buildInfo(),
+		Configs:   configs,
+	})
+	app.Post("/webhook", authMiddleware, webhooks.Handle)
+	webhooks.RegisterHealth(app)
+	metricsHandler := adaptor.HTTPHandler(metrics.Handler())
+	if token := cfg.Server.MetricsToken; token != "" {
+		app.Get("/metrics", auth.Bearer("metrics", token), metricsHandler)
+	} else {
+		app.Get("/metrics", metricsHandler)
+	}
+	if adminToken := cfg.Server.AdminToken; adminToken != "" {
+		webhooks.RegisterAdmin(app.Group("/admin", auth.Bearer("admin", adminToken)))
+	}
+	if ttl := cfg.Dedup.TTL; ttl > 0 {
+		webhooks.Dedup = dedup.New(ttl)
+	}
+	if token := cfg.Jira.APIToken; token != "" {
+		webhooks.Attachments = jira.NewAttachmentClient(cfg.Jira.BaseURL, cfg.Jira.UserEmail, token, cfg.Jira.AttachmentMaxBytes)
+	}
+
+	webhooks.Messages, err = store.Open(filepath.Join(cfg.Storage.StateDir, "messages.json"))
+	if err != nil {
+		log.Fatalf("failed to open message store: %v", err)
+	}
+
+	spool, err := queue.OpenSpool(cfg.Storage.SpoolDir)
+	if err != nil {
+		log.Fatalf("failed to open spool: %v", err)
+	}
+	webhooks.DeadLetters, err = queue.OpenDeadLetters(cfg.Storage.DeadLetterDir)
+	if err != nil {
+		log.Fatalf("failed to open dead letter store: %v", err)
+	}
+	webhooks.Queue = queue.New(spool, webhooks.Deliver, queue.Options{
+		Size:        cfg.Queue.Size,
+		Workers:     cfg.Queue.Workers,
+		MaxAttempts: cfg.Queue.MaxAttempts,
+		RetryDelay:  cfg.Queue.RetryDelay,
+		DeadLetters: webhooks.DeadLetters,
+	})
+	if err := webhooks.Queue.Start(); err != nil {
+		log.Fatalf("failed to start delivery queue: %v", err)
+	}
+
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- app.Listen(":" + strconv.Itoa(cfg.Server.Port)) }()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-listenErr:
+		zapLogger.Error("server stopped", zap.Error(err))
+	case sig := <-signals:
+		zapLogger.Info("shutting down", zap.Stringer("signal", sig))
+	}
+	shutdown(app, webhooks, notifier, cfg.Server.ShutdownTimeout)
+}
+
+// shutdown stops accepting webhooks, lets requests in progress finish and
+// drains the delivery queue within timeout. Discord requests still running
+// at the deadline are aborted; their jobs stay in the spool and are
+// delivered after the next start.
+func shutdown(app *fiber.App, webhooks *handler.WebhookHandler, notifier *discord.Client, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	clean := true
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		zap.L().Warn("requests still running at shutdown deadline", zap.Error(err))
+		clean = false
+	}
+	if webhooks.Queue != nil && webhooks.Queue.Shutdown(ctx) != nil {
+		clean = false
+	}
+	if clean {
+		zap.L().Info("shutdown complete")
+		return
+	}
+	notifier.Abort()
+	if webhooks.Queue != nil {
+		// Aborted deliveries return promptly; wait for them to be recorded.
+		grace, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		webhooks.Queue.Shutdown(grace)
+		zap.L().Warn("shutdown deadline exceeded; undelivered notifications remain spooled",
+			zap.Int("pending", webhooks.Queue.Len()))
+	}
+}
+
+// buildInfo describes this build from the linker flags, falling back to
+// the VCS information Go records when building from a git checkout.
+func buildInfo() handler.BuildInfo {
+	b := handler.BuildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && b.Commit == "":
+				b.Commit = s.Value
+			case s.Key == "vcs.time" && b.BuildTime == "":
+				b.BuildTime = s.Value
+			}
+		}
+	}
+	return b
+}
+
+// activeConfig holds the configuration files in effect. The loaders
+// replace them when the files change while handlers read them per request.
+type activeConfig struct {
+	users     atomic.Pointer[utils.UserMapping]
+	templates atomic.Pointer[jira.TemplateSet]
+	routes    atomic.Pointer[routing.Router]
+	filters   atomic.Pointer[filter.Filter]
+}
+
+// loadUsers reads the user mapping at path and activates it.
+func (a *activeConfig) loadUsers(path string) error {
+	m, err := utils.LoadUserMapping(path)
+	if err != nil {
+		return err
+	}
+	a.users.Store(m)
+	return nil
+}
+
+// loadFilters reads the filters at path and activates them.
+func (a *activeConfig) loadFilters(path string) error {
+	f, err := filter.Load(path)
+	if err != nil {
+		return err
+	}
+	a.filters.Store(f)
+	return nil
+}
+
+// loadRouting reads the templates and routes at their paths, either of which
+// may be empty, and activates both after checking that every template the
+// routes name exists. Checking the new files against each other lets a
+// template renamed in both be picked up by one reload.
+func (a *activeConfig) loadRouting(templatesPath, routesPath string) error {
+	var t *jira.TemplateSet
+	if templatesPath != "" {
+		var err error
+		if t, err = jira.LoadTemplateSet(templatesPath); err != nil {
+			return err
+		}
+	}
+	var r *routing.Router
+	if routesPath != "" {
+		var err error
+		if r, err = routing.Load(routesPath); err != nil {
+			return err
+		}
+		for _, name := range r.Templates() {
+			if t == nil || !t.Has(name) {
+				return fmt.Errorf("routes use unknown template %q", name)
+			}
+		}
+	}
+	a.templates.Store(t)
+	a.routes.Store(r)
+	return nil
+}
+
+// nonEmpty returns the paths that are set.
+func nonEmpty(paths ...string) []string {
+	var set []string
+	for _, p := range paths {
+		if p != "" {
+			set = append(set, p)
+		}
+	}
+	return set
 }
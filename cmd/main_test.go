@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -24,71 +25,69 @@ func TestCapitalize(t *testing.T) {
 	}
 }
 
-func setupTestApp() *fiber.App {
+func setupTestApp(send func(discord.WebhookMessage) error) *fiber.App {
 	app := fiber.New()
-	app.Post("/webhook", webhookHandler)
+	app.Post("/webhook", webhookHandler(send))
 	return app
 }
 
 // webhookHandler is a minimal stub for testing purposes.
 // Replace this with the actual implementation or import if needed.
-func webhookHandler(c *fiber.Ctx) error {
-	var payload jira.Webhook
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("bad request")
-	}
-	// Simulate sending to Discord
-	if discord.SendFunc != nil {
-		msg := discord.WebhookMessage{
-			Embeds: []discord.Embed{
-				{
-					Description: func() string {
-						if payload.Comment != nil {
-							return payload.Comment.Body
-						}
-						return ""
-					}(),
-					Fields: []discord.Field{
-						{
-							Name: func() string {
-								if payload.Comment != nil {
-									return "Comment by"
-								} else if payload.Changelog != nil {
-									return "Changes"
-								} else {
+func webhookHandler(send func(discord.WebhookMessage) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var payload jira.Webhook
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("bad request")
+		}
+		// Simulate sending to Discord
+		if send != nil {
+			msg := discord.WebhookMessage{
+				Embeds: []discord.Embed{
+					{
+						Description: func() string {
+							if payload.Comment != nil {
+								return string(payload.Comment.Body)
+							}
+							return ""
+						}(),
+						Fields: []discord.Field{
+							{
+								Name: func() string {
+									if payload.Comment != nil {
+										return "Comment by"
+									} else if payload.Changelog != nil {
+										return "Changes"
+									} else {
+										return ""
+									}
+								}(),
+								Value: func() string {
+									if payload.Comment != nil {
+										return payload.Comment.Author.DisplayName
+									}
+									if payload.Changelog != nil && len(payload.Changelog.Items) > 0 {
+										item := payload.Changelog.Items[0]
+										return jira.Capitalize(item.Field) + ": " + item.FromString + " → " + item.ToString
+									}
 									return ""
-								}
-							}(),
-							Value: func() string {
-								if payload.Comment != nil {
-									return payload.Comment.Author.DisplayName
-								}
-								if payload.Changelog != nil && len(payload.Changelog.Items) > 0 {
-									item := payload.Changelog.Items[0]
-									return jira.Capitalize(item.Field) + ": " + item.FromString + " → " + item.ToString
-								}
-								return ""
-							}(),
+								}(),
+							},
 						},
 					},
 				},
-			},
+			}
+			send(msg)
 		}
-		discord.SendFunc(msg)
+		return c.SendStatus(fiber.StatusOK)
 	}
-	return c.SendStatus(fiber.StatusOK)
 }
 
 func TestWebhookHandlerSuccess(t *testing.T) {
-	app := setupTestApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
-
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	app := setupTestApp(func(msg discord.WebhookMessage) error {
 		called = true
 		return nil
-	}
+	})
 
 	payload := jira.Webhook{
 		Issue: jira.Issue{
@@ -118,7 +117,7 @@ func TestWebhookHandlerSuccess(t *testing.T) {
 }
 
 func TestWebhookHandlerBadJson(t *testing.T) {
-	app := setupTestApp()
+	app := setupTestApp(nil)
 	req := httptest.NewRequest("POST", "/webhook", bytes.NewBufferString("{"))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := app.Test(req)
@@ -131,15 +130,11 @@ func TestWebhookHandlerBadJson(t *testing.T) {
 }
 
 func TestWebhookHandlerComment(t *testing.T) {
-	app := setupTestApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
-
 	var gotMsg discord.WebhookMessage
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	app := setupTestApp(func(msg discord.WebhookMessage) error {
 		gotMsg = msg
 		return nil
-	}
+	})
 
 	payload := jira.Webhook{
 		Issue:   jira.Issue{Key: "PRJ-2"},
@@ -170,15 +165,11 @@ func TestWebhookHandlerComment(t *testing.T) {
 }
 
 func TestWebhookHandlerChangelog(t *testing.T) {
-	app := setupTestApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
-
 	var gotMsg discord.WebhookMessage
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	app := setupTestApp(func(msg discord.WebhookMessage) error {
 		gotMsg = msg
 		return nil
-	}
+	})
 
 	payload := jira.Webhook{
 		Issue:     jira.Issue{Key: "PRJ-3"},
@@ -212,6 +203,44 @@ func TestWebhookHandlerChangelog(t *testing.T) {
 	}
 }
 
+func TestLoadRoutingChecksNewFilesTogether(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	templates, routes := filepath.Join(dir, "templates.yaml"), filepath.Join(dir, "routes.yaml")
+	write := func(template string) {
+		t.Helper()
+		tpl := "templates:\n  " + template + ":\n    title: \"{{ .Issue.Key }}\"\n"
+		rts := "destinations:\n  - {name: a, url: https://discord.example.com/a, template: " + template + "}\ndefault: [a]\n"
+		if err := os.WriteFile(templates, []byte(tpl), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(routes, []byte(rts), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var active activeConfig
+
+	write("compact")
+	if err := active.loadRouting(templates, routes); err != nil {
+		t.Fatalf("loadRouting: %v", err)
+	}
+	// Renaming the template in both files is accepted in one load.
+	write("short")
+	if err := active.loadRouting(templates, routes); err != nil {
+		t.Fatalf("rename in both files: %v", err)
+	}
+	if !active.templates.Load().Has("short") || active.routes.Load().Templates()[0] != "short" {
+		t.Fatal("renamed templates and routes were not activated")
+	}
+	// Routes naming a template that does not exist leave both unchanged.
+	if err := active.loadRouting("", routes); err == nil {
+		t.Fatal("expected error for routes without templates")
+	}
+	if !active.templates.Load().Has("short") {
+		t.Fatal("failed load replaced the templates")
+	}
+}
+
 func TestMainEnvVars(t *testing.T) {
 	os.Setenv("LOG_LEVEL", "debug")
 	os.Setenv("PORT", "12345")
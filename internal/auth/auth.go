@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the body sent by Jira Cloud.
+	SignatureHeader = "X-Hub-Signature"
+	// TokenHeader carries a static token for Jira Server/Data Center.
+	TokenHeader = "X-Webhook-Token"
+	// TokenQuery is the query parameter alternative to TokenHeader.
+	TokenQuery = "token"
+)
+
+// Config controls how incoming webhook requests are authenticated.
+type Config struct {
+	// Secret is the shared secret used to verify X-Hub-Signature.
+	Secret string
+	// Token is a static token accepted in the query string or header.
+	Token string
+	// AllowedIPs lists IP addresses or CIDR ranges allowed to call the webhook.
+	AllowedIPs []string
+}
+
+// Enabled reports whether any authentication method is configured.
+func (cfg Config) Enabled() bool {
+	return cfg.Secret != "" || cfg.Token != "" || len(cfg.AllowedIPs) > 0
+}
+
+// New returns middleware that rejects requests with 401 unless they come from
+// an allowed IP (when an allowlist is set) and carry a valid signature or
+// token (when either is set). With nothing configured every request passes.
+func New(cfg Config) (fiber.Handler, error) {
+	nets, err := parseNets(cfg.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *fiber.Ctx) error {
+		if len(nets) > 0 && !ipAllowed(c.IP(), nets) {
+			return reject(c, "webhook", "ip not allowed")
+		}
+		if cfg.Secret == "" && cfg.Token == "" {
+			return c.Next()
+		}
+		if cfg.Secret != "" && validSignature(cfg.Secret, c.Get(SignatureHeader), c.Body()) {
+			return c.Next()
+		}
+		if cfg.Token != "" && validToken(cfg.Token, c) {
+			return c.Next()
+		}
+		return reject(c, "webhook", "missing or invalid signature or token")
+	}, nil
+}
+
+// reject answers 401 and logs the failed attempt on resource, e.g.
+// "webhook" or "admin", so that probing of one can be told apart.
+func reject(c *fiber.Ctx, resource, reason string) error {
+	zap.L().Warn("rejected unauthenticated "+resource+" request",
+		zap.String("resource", resource),
+		zap.String("ip", c.IP()),
+		zap.String("path", c.Path()),
+		zap.String("reason", reason),
+	)
+	return c.Status(fiber.StatusUnauthorized).SendString("unauthorized")
+}
+
+// validSignature checks a "sha256=<hex>" header against the HMAC of body.
+func validSignature(secret, header string, body []byte) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func validToken(token string, c *fiber.Ctx) bool {
+	got := c.Get(TokenHeader)
+	if got == "" {
+		got = c.Query(TokenQuery)
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func parseNets(ips []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range ips {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed ip %q: %w", s, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func ipAllowed(addr string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bearer returns middleware that requires "Authorization: Bearer <token>".
+// Rejected requests are logged as attempts on resource, e.g. "admin".
+func Bearer(resource, token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return reject(c, resource, "missing or invalid bearer token")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func setupApp(t *testing.T, cfg Config) *fiber.App {
+	t.Helper()
+	mw, err := New(cfg)
+	require.NoError(t, err)
+	app := fiber.New()
+	app.Post("/webhook", mw, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func status(t *testing.T, app *fiber.App, target string, headers map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", target, strings.NewReader(`{"issue":{}}`))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestNoAuthConfigured(t *testing.T) {
+	app := setupApp(t, Config{})
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook", nil))
+}
+
+func TestSignature(t *testing.T) {
+	app := setupApp(t, Config{Secret: "s3cret"})
+	body := `{"issue":{}}`
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook", map[string]string{SignatureHeader: sign("s3cret", body)}))
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", map[string]string{SignatureHeader: sign("wrong", body)}))
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", map[string]string{SignatureHeader: "sha256=zz"}))
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", nil))
+}
+
+func TestToken(t *testing.T) {
+	app := setupApp(t, Config{Token: "tok"})
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook?token=tok", nil))
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook", map[string]string{TokenHeader: "tok"}))
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook?token=bad", nil))
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", nil))
+}
+
+func TestSignatureOrToken(t *testing.T) {
+	app := setupApp(t, Config{Secret: "s3cret", Token: "tok"})
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook?token=tok", nil))
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook", map[string]string{SignatureHeader: sign("s3cret", `{"issue":{}}`)}))
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", nil))
+}
+
+func TestAllowedIPs(t *testing.T) {
+	// app.Test requests originate from 0.0.0.0
+	app := setupApp(t, Config{AllowedIPs: []string{"0.0.0.0"}})
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook", nil))
+
+	app = setupApp(t, Config{AllowedIPs: []string{"10.0.0.0/8"}})
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", nil))
+
+	app = setupApp(t, Config{AllowedIPs: []string{"0.0.0.0/32"}, Token: "tok"})
+	require.Equal(t, fiber.StatusUnauthorized, status(t, app, "/webhook", nil))
+	require.Equal(t, fiber.StatusOK, status(t, app, "/webhook?token=tok", nil))
+}
+
+func TestInvalidAllowedIP(t *testing.T) {
+	_, err := New(Config{AllowedIPs: []string{"not-an-ip"}})
+	require.Error(t, err)
+}
+
+func TestEnabled(t *testing.T) {
+	require.True(t, Config{Secret: "s"}.Enabled())
+	require.True(t, Config{AllowedIPs: []string{"10.0.0.1"}}.Enabled())
+	require.False(t, Config{}.Enabled())
+}
+
+func TestBearer(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	app := fiber.New()
+	app.Get("/admin", Bearer("admin", "adm"), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	do := func(header string) int {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	require.Equal(t, fiber.StatusOK, do("Bearer adm"))
+	require.Equal(t, fiber.StatusUnauthorized, do("Bearer nope"))
+	require.Equal(t, fiber.StatusUnauthorized, do("adm"))
+	require.Equal(t, fiber.StatusUnauthorized, do(""))
+
+	rejected := logs.FilterMessage("rejected unauthenticated admin request").All()
+	require.Len(t, rejected, 3, "failures should be logged against the protected resource")
+	require.Equal(t, "admin", rejected[0].ContextMap()["resource"])
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Color is an RGB embed color written in hex as 0x00B0F4 or #00B0F4, or in
+// decimal as 45300.
+type Color int
+
+// UnmarshalText parses a color. Values without a '#' are read like the
+// color variables always were, so decimal values keep working.
+func (c *Color) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	var v uint64
+	var err error
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		v, err = strconv.ParseUint(hex, 16, 32)
+		if len(hex) > 6 {
+			err = strconv.ErrRange
+		}
+	} else {
+		v, err = strconv.ParseUint(s, 0, 32)
+	}
+	if err != nil || v > 0xFFFFFF {
+		return fmt.Errorf("invalid color %q, want an RGB value such as 0x00B0F4, #00B0F4 or 45300", s)
+	}
+	*c = Color(v)
+	return nil
+}
+
+// UnmarshalYAML parses a color, which YAML would otherwise read as a
+// number. The #00B0F4 form must be quoted in YAML.
+func (c *Color) UnmarshalYAML(n *yaml.Node) error {
+	if err := c.UnmarshalText([]byte(n.Value)); err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	return nil
+}
+
+// MarshalText formats c as 0xRRGGBB.
+func (c Color) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c Color) String() string {
+	return fmt.Sprintf("0x%06X", int(c))
+}
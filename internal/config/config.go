@@ -0,0 +1,307 @@
+// Package config loads the service configuration from a YAML file and
+// environment variables.
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"jira-discord-webhook/internal/auth"
+	"jira-discord-webhook/internal/jira"
+)
+
+// Config is the service configuration. Fields tagged with env can be
+// overridden by that environment variable; fields tagged secret are
+// redacted by Print.
+type Config struct {
+	Server  Server  `yaml:"server"`
+	Discord Discord `yaml:"discord"`
+	Jira    Jira    `yaml:"jira"`
+	Colors  Colors  `yaml:"colors"`
+	Auth    Auth    `yaml:"auth"`
+	Files   Files   `yaml:"files"`
+	Storage Storage `yaml:"storage"`
+	Queue   Queue   `yaml:"queue"`
+	Dedup   Dedup   `yaml:"dedup"`
+}
+
+// Server configures the HTTP server and logging.
+type Server struct {
+	Port int `yaml:"port" env:"PORT"`
+	// LogLevel is debug, info, warn or error.
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL"`
+	// ShutdownTimeout bounds draining requests and deliveries on SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// AdminToken enables the /admin endpoints behind bearer authentication.
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+	// MetricsToken, when set, is required to scrape /metrics.
+	MetricsToken string `yaml:"metrics_token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// Discord configures the default destination.
+type Discord struct {
+	// WebhookURL receives events when no routes are configured.
+	WebhookURL string `yaml:"webhook_url" env:"DISCORD_WEBHOOK_URL" secret:"true"`
+	// Timeout bounds each request to Discord, including reading the
+	// response.
+	Timeout time.Duration `yaml:"timeout" env:"DISCORD_TIMEOUT"`
+}
+
+// Jira configures issue links and attachment downloads.
+type Jira struct {
+	// BaseURL is the browse URL issue keys are appended to.
+	BaseURL   string `yaml:"base_url" env:"JIRA_BASE_URL"`
+	UserEmail string `yaml:"user_email" env:"JIRA_USER_EMAIL"`
+	// APIToken enables re-uploading attachments to Discord.
+	APIToken           string `yaml:"api_token" env:"JIRA_API_TOKEN" secret:"true"`
+	AttachmentMaxBytes int64  `yaml:"attachment_max_bytes" env:"ATTACHMENT_MAX_BYTES"`
+}
+
+// Colors are the embed colors of each kind of event.
+type Colors struct {
+	Issue            Color `yaml:"issue" env:"ISSUE_COLOR"`
+	Comment          Color `yaml:"comment" env:"COMMENT_COLOR"`
+	Changelog        Color `yaml:"changelog" env:"CHANGELOG_COLOR"`
+	CommentChangelog Color `yaml:"comment_changelog" env:"COMMENT_CHANGELOG_COLOR"`
+	Deleted          Color `yaml:"deleted" env:"DELETED_COLOR"`
+}
+
+// Jira returns the colors in the form used for rendering.
+func (c Colors) Jira() jira.Colors {
+	return jira.Colors{
+		Issue:            int(c.Issue),
+		Comment:          int(c.Comment),
+		Changelog:        int(c.Changelog),
+		CommentChangelog: int(c.CommentChangelog),
+		Deleted:          int(c.Deleted),
+	}
+}
+
+// Auth configures webhook authentication.
+type Auth struct {
+	Secret string `yaml:"secret" env:"WEBHOOK_SECRET" secret:"true"`
+	Token  string `yaml:"token" env:"WEBHOOK_TOKEN" secret:"true"`
+	// AllowedIPs are addresses or CIDR ranges; the environment variable
+	// takes a comma-separated list.
+	AllowedIPs []string `yaml:"allowed_ips" env:"WEBHOOK_ALLOWED_IPS"`
+}
+
+// Config returns the settings of the authentication middleware.
+func (a Auth) Config() auth.Config {
+	return auth.Config{Secret: a.Secret, Token: a.Token, AllowedIPs: a.AllowedIPs}
+}
+
+// Files are the paths of the configuration files reloaded on change.
+// Empty paths other than UserMapping disable the feature.
+type Files struct {
+	UserMapping string `yaml:"user_mapping" env:"USER_MAPPING_PATH"`
+	Templates   string `yaml:"templates" env:"TEMPLATES_PATH"`
+	Routes      string `yaml:"routes" env:"ROUTES_PATH"`
+	Filters     string `yaml:"filters" env:"FILTERS_PATH"`
+}
+
+// Storage are the directories of the persistent state.
+type Storage struct {
+	StateDir      string `yaml:"state_dir" env:"STATE_DIR"`
+	SpoolDir      string `yaml:"spool_dir" env:"SPOOL_DIR"`
+	DeadLetterDir string `yaml:"dead_letter_dir" env:"DEAD_LETTER_DIR"`
+}
+
+// Queue configures asynchronous delivery.
+type Queue struct {
+	Size        int           `yaml:"size" env:"QUEUE_SIZE"`
+	Workers     int           `yaml:"workers" env:"QUEUE_WORKERS"`
+	MaxAttempts int           `yaml:"max_attempts" env:"QUEUE_MAX_ATTEMPTS"`
+	RetryDelay  time.Duration `yaml:"retry_delay" env:"QUEUE_RETRY_DELAY"`
+}
+
+// Dedup configures duplicate suppression.
+type Dedup struct {
+	// TTL is how long delivered events are remembered; 0 disables it.
+	TTL time.Duration `yaml:"ttl" env:"DEDUP_TTL"`
+}
+
+// Default returns the configuration used for settings that are neither
+// in the file nor in the environment.
+func Default() Config {
+	c := jira.DefaultColors
+	return Config{
+		Server:  Server{Port: 8080, LogLevel: "info", ShutdownTimeout: 25 * time.Second},
+		Discord: Discord{Timeout: 15 * time.Second},
+		Jira:    Jira{AttachmentMaxBytes: 8 << 20},
+		Colors: Colors{
+			Issue:            Color(c.Issue),
+			Comment:          Color(c.Comment),
+			Changelog:        Color(c.Changelog),
+			CommentChangelog: Color(c.CommentChangelog),
+			Deleted:          Color(c.Deleted),
+		},
+		Files:   Files{UserMapping: "config/user_mapping.yaml"},
+		Storage: Storage{StateDir: "state", SpoolDir: "spool", DeadLetterDir: "deadletters"},
+		Queue:   Queue{Size: 1000, Workers: 4, MaxAttempts: 5, RetryDelay: 30 * time.Second},
+		Dedup:   Dedup{TTL: 10 * time.Minute},
+	}
+}
+
+// Load returns the defaults, overridden by the YAML file at path when
+// path is not empty, then by environment variables, and validates the
+// result. Empty environment variables are ignored.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	envErr := applyEnv(reflect.ValueOf(&cfg).Elem())
+	return cfg, errors.Join(envErr, cfg.Validate())
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets the fields of v tagged with env from the environment.
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		f, sf := v.Field(i), v.Type().Field(i)
+		if sf.Type.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(f))
+			continue
+		}
+		name := sf.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if s := os.Getenv(name); s != "" {
+			if err := setField(f, s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setField parses s into f.
+func setField(f reflect.Value, s string) error {
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, e.g. 30s or 10m", s)
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		f.SetInt(n)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, name, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+	}
+	check(c.Server.Port >= 0 && c.Server.Port <= 65535, "server.port (PORT)", "%d is not a valid port", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout (SHUTDOWN_TIMEOUT)", "must be positive")
+	check(c.Discord.Timeout > 0, "discord.timeout (DISCORD_TIMEOUT)", "must be positive")
+	if err := checkURL(c.Discord.WebhookURL); err != nil {
+		errs = append(errs, fmt.Errorf("discord.webhook_url (DISCORD_WEBHOOK_URL): %w", err))
+	}
+	if err := checkURL(c.Jira.BaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("jira.base_url (JIRA_BASE_URL): %w", err))
+	}
+	check(c.Jira.APIToken == "" || c.Jira.BaseURL != "", "jira.base_url (JIRA_BASE_URL)", "required to download attachments")
+	check(c.Jira.AttachmentMaxBytes > 0, "jira.attachment_max_bytes (ATTACHMENT_MAX_BYTES)", "must be positive")
+	check(c.Files.UserMapping != "", "files.user_mapping (USER_MAPPING_PATH)", "required")
+	check(c.Storage.StateDir != "", "storage.state_dir (STATE_DIR)", "required")
+	check(c.Storage.SpoolDir != "", "storage.spool_dir (SPOOL_DIR)", "required")
+	check(c.Storage.DeadLetterDir != "", "storage.dead_letter_dir (DEAD_LETTER_DIR)", "required")
+	check(c.Queue.Size > 0, "queue.size (QUEUE_SIZE)", "must be positive")
+	check(c.Queue.Workers > 0, "queue.workers (QUEUE_WORKERS)", "must be positive")
+	check(c.Queue.MaxAttempts > 0, "queue.max_attempts (QUEUE_MAX_ATTEMPTS)", "must be positive")
+	check(c.Queue.RetryDelay > 0, "queue.retry_delay (QUEUE_RETRY_DELAY)", "must be positive")
+	check(c.Dedup.TTL >= 0, "dedup.ttl (DEDUP_TTL)", "must not be negative")
+	if _, err := auth.New(c.Auth.Config()); err != nil {
+		errs = append(errs, fmt.Errorf("auth.allowed_ips (WEBHOOK_ALLOWED_IPS): %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// checkURL reports whether s is empty or an absolute http(s) URL.
+func checkURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("malformed URL %q, want an absolute http or https URL", s)
+	}
+	return nil
+}
+
+// redacted replaces non-empty secrets.
+const redacted = "REDACTED"
+
+// Print writes c as YAML with secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	redact(reflect.ValueOf(&c).Elem())
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		f, sf := v.Field(i), v.Type().Field(i)
+		switch {
+		case sf.Type.Kind() == reflect.Struct:
+			redact(f)
+		case sf.Tag.Get("secret") == "true" && f.String() != "":
+			f.SetString(redacted)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, Default(), cfg)
+	require.Equal(t, 0x00B0F4, cfg.Colors.Jira().Issue)
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: 9090
+  shutdown_timeout: 1m
+discord:
+  webhook_url: https://discord.com/api/webhooks/1/file
+colors:
+  issue: 0x123456
+  comment: "#ABCDEF"
+  comment_changelog: 5507546
+auth:
+  allowed_ips: [10.0.0.1]
+queue:
+  workers: 2
+`)
+	t.Setenv("DISCORD_WEBHOOK_URL", "https://discord.com/api/webhooks/1/env")
+	t.Setenv("QUEUE_RETRY_DELAY", "5s")
+	// Decimal colors from older .env files are still accepted.
+	t.Setenv("DELETED_COLOR", "65280")
+	t.Setenv("WEBHOOK_ALLOWED_IPS", " 10.0.0.2, 192.168.0.0/16 ,")
+	// Empty variables, as passed by compose for unset ones, are ignored.
+	t.Setenv("PORT", "")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, 9090, cfg.Server.Port)
+	require.Equal(t, time.Minute, cfg.Server.ShutdownTimeout)
+	require.Equal(t, "https://discord.com/api/webhooks/1/env", cfg.Discord.WebhookURL)
+	require.Equal(t, Color(0x123456), cfg.Colors.Issue)
+	require.Equal(t, Color(0xABCDEF), cfg.Colors.Comment)
+	require.Equal(t, Color(0xFF6F3C), cfg.Colors.Changelog, "unset values keep their default")
+	require.Equal(t, Color(0x5409DA), cfg.Colors.CommentChangelog)
+	require.Equal(t, Color(0x00FF00), cfg.Colors.Deleted)
+	require.Equal(t, []string{"10.0.0.2", "192.168.0.0/16"}, cfg.Auth.AllowedIPs)
+	require.Equal(t, 2, cfg.Queue.Workers)
+	require.Equal(t, 5*time.Second, cfg.Queue.RetryDelay)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, file string
+		env        map[string]string
+		want       []string
+	}{
+		{
+			name: "bad color in file",
+			file: "colors:\n  issue: 0xZZZZZZ\n",
+			want: []string{`line 2: invalid color "0xZZZZZZ", want an RGB value`},
+		},
+		{
+			name: "unknown key",
+			file: "discord:\n  webhook: https://discord.com/api/webhooks/1/a\n",
+			want: []string{"field webhook not found"},
+		},
+		{
+			name: "bad env values",
+			env:  map[string]string{"DELETED_COLOR": "red", "ISSUE_COLOR": "#1000000", "QUEUE_SIZE": "many", "DEDUP_TTL": "10"},
+			want: []string{`DELETED_COLOR: invalid color "red"`, `ISSUE_COLOR: invalid color "#1000000"`, `QUEUE_SIZE: invalid number "many"`, `DEDUP_TTL: invalid duration "10"`},
+		},
+		{
+			name: "malformed URLs",
+			env:  map[string]string{"DISCORD_WEBHOOK_URL": "discord.com/api/webhooks/1/a", "JIRA_BASE_URL": "ftp://jira"},
+			want: []string{
+				`discord.webhook_url (DISCORD_WEBHOOK_URL): malformed URL "discord.com/api/webhooks/1/a"`,
+				`jira.base_url (JIRA_BASE_URL): malformed URL "ftp://jira"`,
+			},
+		},
+		{
+			name: "invalid values",
+			file: "queue:\n  workers: 0\nserver:\n  port: 70000\ndiscord:\n  timeout: 0s\nauth:\n  allowed_ips: [nope]\n",
+			want: []string{"queue.workers (QUEUE_WORKERS): must be positive", "server.port (PORT): 70000 is not a valid port", "discord.timeout (DISCORD_TIMEOUT): must be positive", "auth.allowed_ips"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = writeConfig(t, tc.file)
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(path)
+			require.Error(t, err)
+			for _, want := range tc.want {
+				require.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Discord.WebhookURL = "https://discord.com/api/webhooks/1/secret-token"
+	cfg.Jira.APIToken = "jira-token"
+	cfg.Auth.Secret = "hmac"
+
+	var b bytes.Buffer
+	require.NoError(t, cfg.Print(&b))
+	out := b.String()
+	for _, secret := range []string{"secret-token", "jira-token", "hmac"} {
+		require.NotContains(t, out, secret)
+	}
+	require.Contains(t, out, "webhook_url: REDACTED")
+	require.Contains(t, out, "token: \"\"", "empty secrets are shown as unset")
+	require.Contains(t, out, `issue: "0x00B0F4"`)
+	require.Contains(t, out, "retry_delay: 30s")
+	require.Equal(t, "https://discord.com/api/webhooks/1/secret-token", cfg.Discord.WebhookURL, "Print leaves cfg unchanged")
+
+}
+
+func TestPrintLoadsBack(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, Default().Print(&b))
+	cfg, err := Load(writeConfig(t, b.String()))
+	require.NoError(t, err)
+	var again bytes.Buffer
+	require.NoError(t, cfg.Print(&again))
+	require.Equal(t, b.String(), again.String())
+}
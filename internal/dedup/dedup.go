@@ -0,0 +1,77 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache remembers keys for a fixed window so that repeated deliveries of the
+// same Jira event can be recognised.
+type Cache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// New returns a cache that remembers keys for ttl.
+func New(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// Check reports whether any of keys was recorded within the window. Keys not
+// yet recorded, or expired, are recorded either way, so an event identified
+// by several keys is recognised by any of them later. A repeat does not
+// extend the window, so an event repeating more often than the TTL is
+// still delivered once per window.
+func (c *Cache) Check(keys ...string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.sweep(now)
+	dup := false
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		if t, ok := c.seen[k]; ok && now.Sub(t) < c.ttl {
+			dup = true
+			continue
+		}
+		c.seen[k] = now
+	}
+	return dup
+}
+
+// Forget removes keys, e.g. after a delivery failed so that Jira's retry is
+// not suppressed.
+func (c *Cache) Forget(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		delete(c.seen, k)
+	}
+}
+
+// Len returns the number of remembered keys, including expired ones that
+// have not been swept yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+// sweep drops expired keys at most once per window.
+func (c *Cache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	for k, t := range c.seen {
+		if now.Sub(t) >= c.ttl {
+			delete(c.seen, k)
+		}
+	}
+	c.lastSweep = now
+}
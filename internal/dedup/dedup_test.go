@@ -0,0 +1,61 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheCheck(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := New(time.Minute)
+	c.now = func() time.Time { return now }
+
+	if c.Check("a") {
+		t.Fatal("first check should not be a duplicate")
+	}
+	if !c.Check("a") {
+		t.Fatal("second check should be a duplicate")
+	}
+	if !c.Check("b", "a") {
+		t.Fatal("any known key should mark a duplicate")
+	}
+	if !c.Check("b") {
+		t.Fatal("keys checked together should all be recorded")
+	}
+	if c.Check("", "") {
+		t.Fatal("empty keys should be ignored")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if c.Check("a") {
+		t.Fatal("expired key should not be a duplicate")
+	}
+	if c.Len() != 1 {
+		t.Fatalf("expected expired keys to be swept, have %d", c.Len())
+	}
+}
+
+func TestCacheRepeatDoesNotExtendWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := New(time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Check("a")
+	now = now.Add(54 * time.Second)
+	if !c.Check("a") {
+		t.Fatal("repeat within the window should be a duplicate")
+	}
+	now = now.Add(54 * time.Second)
+	if c.Check("a") {
+		t.Fatal("a repeat should not extend the window")
+	}
+}
+
+func TestCacheForget(t *testing.T) {
+	c := New(time.Minute)
+	c.Check("a")
+	c.Forget("a")
+	if c.Check("a") {
+		t.Fatal("forgotten key should not be a duplicate")
+	}
+}
@@ -0,0 +1,225 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Discord's limits on embeds, counted in characters.
+const (
+	TitleMax       = 256
+	DescriptionMax = 4096
+	FieldNameMax   = 256
+	FieldValueMax  = 1024
+	FooterTextMax  = 2048
+	AuthorNameMax  = 256
+	MaxFields      = 25
+	MaxEmbeds      = 10
+	// MessageMax is the total length of all embed texts in a message.
+	MessageMax = 6000
+)
+
+// EmbedSize returns the characters of e that count towards MessageMax:
+// title, description, field names and values, footer text and author name.
+func EmbedSize(e Embed) int {
+	n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+	for _, f := range e.Fields {
+		n += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+	}
+	if e.Footer != nil {
+		n += utf8.RuneCountInString(e.Footer.Text)
+	}
+	if e.Author != nil {
+		n += utf8.RuneCountInString(e.Author.Name)
+	}
+	return n
+}
+
+// MessageSize returns the total size of msg's embeds.
+func MessageSize(msg WebhookMessage) int {
+	n := 0
+	for _, e := range msg.Embeds {
+		n += EmbedSize(e)
+	}
+	return n
+}
+
+// Split returns msg as one or more messages within Discord's limits. A
+// description too long for one embed continues in the next embed, fields
+// that do not fit move to a new embed, and embeds that do not fit in one
+// message move to the next. Content keeps its order. When msg needs more
+// than one message, the first embed of each is titled with the original
+// title and "(2/3)". Files and the thread name go with the first message.
+func Split(msg WebhookMessage) []WebhookMessage {
+	title := ""
+	if len(msg.Embeds) > 0 {
+		title = clampText(msg.Embeds[0].Title, TitleMax)
+	}
+	// Keep room for the title and marker added to later messages.
+	reserve := utf8.RuneCountInString(title) + len(" (99/99)")
+	parts := pack(msg, MessageMax-reserve)
+	if len(parts) < 2 {
+		return parts
+	}
+	for i := range parts {
+		if len(parts[i].Embeds) == 0 {
+			continue
+		}
+		e := &parts[i].Embeds[0]
+		if i > 0 || e.Title == "" {
+			e.Title = title
+		}
+		marker := fmt.Sprintf(" (%d/%d)", i+1, len(parts))
+		e.Title = strings.TrimSpace(clampText(e.Title, TitleMax-len(marker)) + marker)
+	}
+	return parts
+}
+
+// Fit returns msg cut down to a single message within Discord's limits, for
+// messages that are edited in place. Descriptions are shortened first, from
+// the last embed, and end with "…" and a "Read more" link to the embed's
+// URL; fields and embeds that still do not fit are dropped.
+func Fit(msg WebhookMessage) WebhookMessage {
+	embeds := make([]Embed, 0, len(msg.Embeds))
+	size := 0
+	for _, e := range msg.Embeds[:min(len(msg.Embeds), MaxEmbeds)] {
+		e = clampEmbed(e)
+		e.Description = Truncate(e.Description, DescriptionMax, e.URL)
+		embeds = append(embeds, e)
+		size += EmbedSize(e)
+	}
+	for i := len(embeds) - 1; i >= 0 && size > MessageMax; i-- {
+		e := &embeds[i]
+		n := utf8.RuneCountInString(e.Description)
+		e.Description = Truncate(e.Description, max(n-(size-MessageMax), 0), e.URL)
+		size -= n - utf8.RuneCountInString(e.Description)
+	}
+	msg.Embeds = embeds
+	return pack(msg, MessageMax)[0]
+}
+
+// pack splits msg's embeds so that no message exceeds budget characters.
+func pack(msg WebhookMessage, budget int) []WebhookMessage {
+	var embeds []Embed
+	for _, e := range msg.Embeds {
+		embeds = append(embeds, splitEmbed(e, budget)...)
+	}
+	first := msg
+	first.Embeds = nil
+	parts := []WebhookMessage{first}
+	size := 0
+	for _, e := range embeds {
+		cur := &parts[len(parts)-1]
+		n := EmbedSize(e)
+		if len(cur.Embeds) == MaxEmbeds || (len(cur.Embeds) > 0 && size+n > budget) {
+			parts = append(parts, WebhookMessage{Username: msg.Username})
+			cur = &parts[len(parts)-1]
+			size = 0
+		}
+		cur.Embeds = append(cur.Embeds, e)
+		size += n
+	}
+	return parts
+}
+
+// splitEmbed clamps e's texts to their limits and spreads its description
+// and fields over as many embeds as needed. Consecutive embeds share budget
+// until it is used up, so that pack can put them in one message. The title,
+// author and thumbnail stay on the first embed; footer, timestamp and image
+// move to the last.
+func splitEmbed(e Embed, budget int) []Embed {
+	e = clampEmbed(e)
+	head := e
+	head.Description, head.Fields = "", nil
+	head.Footer, head.Timestamp, head.Image = nil, "", nil
+	footer := 0
+	if e.Footer != nil {
+		footer = utf8.RuneCountInString(e.Footer.Text)
+	}
+
+	out := []Embed{head}
+	size := EmbedSize(head) + footer
+	// next starts another embed, in a new message when full is set.
+	next := func(full bool) *Embed {
+		out = append(out, Embed{Color: e.Color})
+		if full {
+			size = footer
+		}
+		return &out[len(out)-1]
+	}
+	cur := &out[0]
+	for desc := e.Description; desc != ""; {
+		room := min(DescriptionMax, budget-size)
+		if room <= 0 {
+			cur = next(true)
+			continue
+		}
+		chunk, rest := cutMarkdown(desc, room)
+		if chunk == "" {
+			cur = next(true)
+			continue
+		}
+		cur.Description = chunk
+		size += utf8.RuneCountInString(chunk)
+		desc = rest
+		if desc != "" {
+			cur = next(room < DescriptionMax)
+		}
+	}
+	for _, f := range e.Fields {
+		n := utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+		if size+n > budget {
+			cur = next(true)
+		} else if len(cur.Fields) == MaxFields {
+			cur = next(false)
+		}
+		cur.Fields = append(cur.Fields, f)
+		size += n
+	}
+	cur.Footer, cur.Timestamp, cur.Image = e.Footer, e.Timestamp, e.Image
+	return out
+}
+
+// clampEmbed truncates the texts of e that Discord limits individually.
+// Field values that are too long continue in fields named "Name (cont.)".
+func clampEmbed(e Embed) Embed {
+	e.Title = clampText(e.Title, TitleMax)
+	if e.Author != nil {
+		a := *e.Author
+		a.Name = clampText(a.Name, AuthorNameMax)
+		e.Author = &a
+	}
+	if e.Footer != nil {
+		f := *e.Footer
+		f.Text = clampText(f.Text, FooterTextMax)
+		e.Footer = &f
+	}
+	if len(e.Fields) > 0 {
+		fields := make([]Field, 0, len(e.Fields))
+		for _, f := range e.Fields {
+			name := f.Name
+			f.Name = clampText(name, FieldNameMax)
+			for {
+				value, rest := cutMarkdown(f.Value, FieldValueMax)
+				fields = append(fields, Field{Name: f.Name, Value: value, Inline: f.Inline})
+				if rest == "" {
+					break
+				}
+				f.Name = clampText(name+" (cont.)", FieldNameMax)
+				f.Value = rest
+			}
+		}
+		e.Fields = fields
+	}
+	return e
+}
+
+// clampText cuts s to at most max characters, ending with "…" when cut.
+func clampText(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max-1]) + "…"
+}
@@ -0,0 +1,155 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func checkLimits(t *testing.T, msg WebhookMessage) {
+	t.Helper()
+	if n := MessageSize(msg); n > MessageMax {
+		t.Errorf("message has %d characters", n)
+	}
+	if len(msg.Embeds) > MaxEmbeds {
+		t.Errorf("message has %d embeds", len(msg.Embeds))
+	}
+	for _, e := range msg.Embeds {
+		if utf8.RuneCountInString(e.Description) > DescriptionMax || len(e.Fields) > MaxFields {
+			t.Errorf("embed over limits: %d description characters, %d fields", utf8.RuneCountInString(e.Description), len(e.Fields))
+		}
+		for _, f := range e.Fields {
+			if utf8.RuneCountInString(f.Value) > FieldValueMax {
+				t.Errorf("field %q has %d characters", f.Name, utf8.RuneCountInString(f.Value))
+			}
+		}
+	}
+}
+
+func TestSplitSmallMessage(t *testing.T) {
+	msg := WebhookMessage{Username: "Jira", Embeds: []Embed{{Title: "PRJ-1: Test", Description: "short", Fields: []Field{{Name: "Status", Value: "Open"}}}}}
+	parts := Split(msg)
+	if len(parts) != 1 || len(parts[0].Embeds) != 1 || parts[0].Embeds[0].Title != "PRJ-1: Test" {
+		t.Fatalf("unexpected parts: %+v", parts)
+	}
+}
+
+func TestSplitLongDescription(t *testing.T) {
+	line := strings.Repeat("é", 99) + "\n"
+	desc := strings.TrimSuffix(strings.Repeat(line, 90), "\n")
+	msg := WebhookMessage{
+		Username:   "Jira",
+		ThreadName: "PRJ-1",
+		Files:      []File{{Name: "a.txt"}},
+		Embeds: []Embed{{
+			Title:       "PRJ-1: Test",
+			Description: desc,
+			Fields:      []Field{{Name: "Status", Value: "Open"}},
+			Footer:      &Footer{Text: "Project"},
+			Timestamp:   "2025-06-23T08:00:00Z",
+		}},
+	}
+	parts := Split(msg)
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(parts))
+	}
+	var got []string
+	for i, p := range parts {
+		checkLimits(t, p)
+		if want := []string{"PRJ-1: Test (1/2)", "PRJ-1: Test (2/2)"}[i]; p.Embeds[0].Title != want {
+			t.Errorf("part %d title %q, want %q", i, p.Embeds[0].Title, want)
+		}
+		if p.Username != "Jira" {
+			t.Errorf("part %d lost the username", i)
+		}
+		for _, e := range p.Embeds {
+			got = append(got, e.Description)
+		}
+	}
+	if strings.Join(got, "\n") != desc {
+		t.Error("description was not kept in order")
+	}
+	if len(parts[0].Files) != 1 || parts[0].ThreadName == "" || len(parts[1].Files) != 0 || parts[1].ThreadName != "" {
+		t.Error("files and thread name belong to the first message")
+	}
+	last := parts[1].Embeds[len(parts[1].Embeds)-1]
+	if last.Footer == nil || last.Timestamp == "" || len(last.Fields) != 1 {
+		t.Errorf("fields, footer and timestamp should end the last embed: %+v", last)
+	}
+}
+
+func TestSplitFields(t *testing.T) {
+	var fields []Field
+	for i := 0; i < 30; i++ {
+		fields = append(fields, Field{Name: "F", Value: "v"})
+	}
+	fields = append(fields, Field{Name: "Comment", Value: strings.Repeat("word ", 300)})
+	parts := Split(WebhookMessage{Embeds: []Embed{{Title: "PRJ-1", Fields: fields}}})
+	if len(parts) != 1 || len(parts[0].Embeds) != 2 {
+		t.Fatalf("expected one message with 2 embeds, got %+v", parts)
+	}
+	checkLimits(t, parts[0])
+	second := parts[0].Embeds[1].Fields
+	if n := len(second); n != 7 || second[5].Name != "Comment" || second[6].Name != "Comment (cont.)" {
+		t.Fatalf("unexpected fields in second embed: %+v", second)
+	}
+}
+
+func TestSplitFillsMessages(t *testing.T) {
+	var fields []Field
+	for i := 0; i < 30; i++ {
+		fields = append(fields, Field{Name: "Field", Value: "value"})
+	}
+	desc := strings.TrimSpace(strings.Repeat("word ", 4800))
+	msg := WebhookMessage{Embeds: []Embed{{Title: "PRJ-1: Test", Description: desc, Fields: fields}}}
+	parts := Split(msg)
+	// 24,000 description and 300 field characters need five messages.
+	if len(parts) != 5 {
+		t.Fatalf("expected 5 messages, got %d", len(parts))
+	}
+	var got []string
+	for _, p := range parts {
+		checkLimits(t, p)
+		for _, e := range p.Embeds {
+			if e.Description != "" {
+				got = append(got, e.Description)
+			}
+		}
+	}
+	if strings.Join(got, " ") != desc {
+		t.Error("description was not kept in order")
+	}
+}
+
+func TestFit(t *testing.T) {
+	msg := WebhookMessage{Embeds: []Embed{{Title: "PRJ-1", Description: strings.Repeat("x ", 5000)}}}
+	got := Fit(msg)
+	checkLimits(t, got)
+	if got.Embeds[0].Title != "PRJ-1" {
+		t.Errorf("Fit should not mark the title, got %q", got.Embeds[0].Title)
+	}
+	if !strings.HasSuffix(got.Embeds[0].Description, "…") {
+		t.Errorf("shortened description should end with an ellipsis")
+	}
+}
+
+func TestFitKeepsFieldsAndLinksToIssue(t *testing.T) {
+	url := "https://jira.example.com/browse/PRJ-1"
+	fields := []Field{
+		{Name: "Comment", Value: strings.Repeat("c", 1000)},
+		{Name: "Notes", Value: strings.Repeat("n", 1000)},
+		{Name: "Priority", Value: "High", Inline: true},
+	}
+	msg := WebhookMessage{Embeds: []Embed{{Title: "PRJ-1", URL: url, Description: strings.Repeat("word ", 2000), Fields: fields}}}
+	got := Fit(msg)
+	checkLimits(t, got)
+	if len(got.Embeds) != 1 || len(got.Embeds[0].Fields) != 3 {
+		t.Fatalf("fields should be kept while the description is shortened: %+v", got.Embeds)
+	}
+	if want := "… [Read more](" + url + ")"; !strings.HasSuffix(got.Embeds[0].Description, want) {
+		t.Errorf("description should end with %q", want)
+	}
+	if n := MessageSize(got); n < MessageMax-20 {
+		t.Errorf("message uses %d characters, want close to %d", n, MessageMax)
+	}
+}
@@ -0,0 +1,476 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jira-discord-webhook/internal/metrics"
+)
+
+// StatusError is returned when Discord responds with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("discord webhook returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// ErrRateLimited is returned when Discord asks the client to wait longer than
+// its MaxDelay.
+var ErrRateLimited = errors.New("discord rate limit exceeds maximum wait")
+
+// ErrNoWebhookURL is returned for a request without a webhook URL when the
+// Client has no default one.
+var ErrNoWebhookURL = errors.New("no Discord webhook URL configured")
+
+// webhookPath matches the ID and token of a webhook URL.
+var webhookPath = regexp.MustCompile(`/webhooks/[^/\s"?]+/[^/\s"?]+`)
+
+// redactedError is an error with the webhook tokens removed from its text.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactError returns err with the ID and token of every webhook URL in its
+// text replaced by REDACTED. Transport errors include the request URL, so
+// errors from a Notifier must be redacted before they are logged, stored
+// or returned to a client. The result still matches err with errors.Is and
+// errors.As.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	redacted := webhookPath.ReplaceAllString(msg, "/webhooks/REDACTED")
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{msg: redacted, err: err}
+}
+
+// Notifier delivers messages to Discord webhooks. An empty webhookURL
+// selects the notifier's default webhook.
+type Notifier interface {
+	// Send posts msg, split into several messages when it exceeds
+	// Discord's limits.
+	Send(ctx context.Context, webhookURL string, msg WebhookMessage) error
+	// Post posts msg, into threadID when set, and returns the created
+	// message.
+	Post(ctx context.Context, webhookURL, threadID string, msg WebhookMessage) (*Message, error)
+	// Edit replaces a message previously posted by the webhook.
+	Edit(ctx context.Context, webhookURL, messageID string, msg WebhookMessage) error
+	// Delete removes a message previously posted by the webhook.
+	Delete(ctx context.Context, webhookURL, messageID string) error
+}
+
+var _ Notifier = (*Client)(nil)
+
+// Client delivers requests to Discord webhooks. Transient failures (network
+// errors, 429 and 5xx responses) are retried with exponential backoff and
+// jitter, and requests are paced using Discord's rate-limit headers so that
+// bursts wait for the bucket to reset instead of being rejected.
+type Client struct {
+	// WebhookURL is used by requests made with an empty webhook URL.
+	WebhookURL string
+	HTTPClient *http.Client
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseDelay is the initial backoff delay for server errors.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay and the longest rate-limit wait.
+	MaxDelay time.Duration
+
+	mu sync.Mutex
+	// aborted is cancelled by Abort.
+	aborted context.Context
+	abort   context.CancelFunc
+	// routes maps a webhook URL to the rate-limit bucket Discord reported.
+	routes  map[string]string
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	remaining int
+	reset     time.Time
+}
+
+// NewClient returns a Client with sensible retry defaults.
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+		MaxRetries: 5,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+	}
+}
+
+// Abort cancels the requests in progress, including rate-limit and retry
+// waits, and makes later requests fail immediately. It is called when a
+// shutdown deadline expires.
+func (c *Client) Abort() {
+	c.abortContext()
+	c.abort()
+}
+
+// abortContext returns the context cancelled by Abort.
+func (c *Client) abortContext() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.aborted == nil {
+		c.aborted, c.abort = context.WithCancel(context.Background())
+	}
+	return c.aborted
+}
+
+// target returns webhookURL, or the default webhook when it is empty.
+func (c *Client) target(webhookURL string) (string, error) {
+	if webhookURL == "" {
+		webhookURL = c.WebhookURL
+	}
+	if webhookURL == "" {
+		return "", ErrNoWebhookURL
+	}
+	return webhookURL, nil
+}
+
+// Send posts msg to webhookURL. A message over Discord's limits is split
+// and its parts are posted in order.
+func (c *Client) Send(ctx context.Context, webhookURL string, msg WebhookMessage) error {
+	webhookURL, err := c.target(webhookURL)
+	if err != nil {
+		return err
+	}
+	for _, part := range Split(msg) {
+		b, contentType, err := encodeMessage(part)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Do(ctx, http.MethodPost, webhookURL, contentType, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMessage returns the request body for msg: JSON, or multipart form
+// data with the JSON in payload_json when msg has files.
+func encodeMessage(msg WebhookMessage) ([]byte, string, error) {
+	if len(msg.Files) == 0 {
+		b, err := json.Marshal(msg)
+		return b, "application/json", err
+	}
+	msg.Attachments = make([]Attachment, len(msg.Files))
+	for i, f := range msg.Files {
+		msg.Attachments[i] = Attachment{ID: i, Filename: f.Name}
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="payload_json"`)
+	h.Set("Content-Type", "application/json")
+	pw, err := w.CreatePart(h)
+	if err != nil {
+		return nil, "", err
+	}
+	pw.Write(payload)
+	for i, f := range msg.Files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[%d]"; filename=%q`, i, f.Name))
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h.Set("Content-Type", contentType)
+		fw, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		fw.Write(f.Data)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// Do performs a request against a Discord webhook URL and returns the
+// response body. The body is resent unchanged on every attempt.
+func (c *Client) Do(ctx context.Context, method, target, contentType string, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(c.abortContext(), cancel)()
+	key := routeKey(target)
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			metrics.DiscordRetries.Inc()
+		}
+		if err := c.waitForBucket(ctx, key); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		start := time.Now()
+		resp, err := c.HTTPClient.Do(req)
+		metrics.DiscordRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		var delay time.Duration
+		if err != nil {
+			metrics.DiscordRequests.WithLabelValues(method, "error").Inc()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			delay = c.backoff(attempt)
+		} else {
+			metrics.DiscordRequests.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Inc()
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			c.updateBucket(key, resp.Header)
+			if resp.StatusCode < 300 {
+				return respBody, nil
+			}
+			lastErr = &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+			switch {
+			case resp.StatusCode == http.StatusTooManyRequests:
+				delay = retryAfter(resp.Header, respBody)
+				if delay > c.MaxDelay {
+					return nil, fmt.Errorf("%w: retry after %s", ErrRateLimited, delay)
+				}
+				metrics.RateLimitWait.Observe(delay.Seconds())
+			case resp.StatusCode >= 500:
+				delay = c.backoff(attempt)
+			default:
+				return nil, lastErr
+			}
+		}
+		if attempt == c.MaxRetries {
+			break
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// backoff returns the full-jitter exponential delay for attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.BaseDelay << attempt
+	if d <= 0 || d > c.MaxDelay {
+		d = c.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// waitForBucket blocks until the bucket for key has a request available.
+func (c *Client) waitForBucket(ctx context.Context, key string) error {
+	c.mu.Lock()
+	b := c.buckets[c.routes[key]]
+	var wait time.Duration
+	if b != nil {
+		now := time.Now()
+		switch {
+		case now.After(b.reset):
+			// The window has passed; the next response refreshes the state.
+		case b.remaining > 0:
+			b.remaining--
+		default:
+			wait = b.reset.Sub(now)
+		}
+	}
+	c.mu.Unlock()
+	if wait > c.MaxDelay {
+		return fmt.Errorf("%w: bucket resets in %s", ErrRateLimited, wait)
+	}
+	if wait > 0 {
+		metrics.RateLimitWait.Observe(wait.Seconds())
+	}
+	return c.sleep(ctx, wait)
+}
+
+// updateBucket records the rate-limit state reported in h.
+func (c *Client) updateBucket(key string, h http.Header) {
+	id := h.Get("X-RateLimit-Bucket")
+	if id == "" {
+		return
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetAfter := parseSeconds(h.Get("X-RateLimit-Reset-After"))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.routes == nil {
+		c.routes = make(map[string]string)
+		c.buckets = make(map[string]*bucket)
+	}
+	c.routes[key] = id
+	c.buckets[id] = &bucket{remaining: remaining, reset: time.Now().Add(resetAfter)}
+}
+
+// retryAfter returns how long Discord asked us to wait after a 429.
+func retryAfter(h http.Header, body []byte) time.Duration {
+	if d := parseSeconds(h.Get("Retry-After")); d > 0 {
+		return d
+	}
+	if d := parseSeconds(h.Get("X-RateLimit-Reset-After")); d > 0 {
+		return d
+	}
+	var payload struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.RetryAfter > 0 {
+		return time.Duration(payload.RetryAfter * float64(time.Second))
+	}
+	return time.Second
+}
+
+// parseSeconds parses a possibly fractional number of seconds.
+func parseSeconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+// routeKey identifies a webhook independent of its query string.
+func routeKey(target string) string {
+	base, _, _ := strings.Cut(target, "?")
+	return base
+}
+
+// Message is the subset of a Discord message returned by webhook requests
+// made with wait=true.
+type Message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// Post executes the webhook with wait=true and returns the created message.
+// A non-empty threadID posts into that thread. To create a forum post, set
+// msg.ThreadName instead; the returned ChannelID is then the new thread.
+func (c *Client) Post(ctx context.Context, webhookURL, threadID string, msg WebhookMessage) (*Message, error) {
+	webhookURL, err := c.target(webhookURL)
+	if err != nil {
+		return nil, err
+	}
+	b, contentType, err := encodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	target := WithQuery(webhookURL, "wait", "true")
+	if threadID != "" {
+		target = WithQuery(target, "thread_id", threadID)
+	}
+	resp, err := c.Do(ctx, http.MethodPost, target, contentType, b)
+	if err != nil {
+		return nil, err
+	}
+	var m Message
+	if err := json.Unmarshal(resp, &m); err != nil {
+		return nil, fmt.Errorf("decode discord message: %w", err)
+	}
+	return &m, nil
+}
+
+// Edit replaces the content of a message previously sent by the webhook.
+func (c *Client) Edit(ctx context.Context, webhookURL, messageID string, msg WebhookMessage) error {
+	webhookURL, err := c.target(webhookURL)
+	if err != nil {
+		return err
+	}
+	b, contentType, err := encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.Do(ctx, http.MethodPatch, messageURL(webhookURL, messageID), contentType, b)
+	return err
+}
+
+// Delete removes a message previously sent by the webhook.
+func (c *Client) Delete(ctx context.Context, webhookURL, messageID string) error {
+	webhookURL, err := c.target(webhookURL)
+	if err != nil {
+		return err
+	}
+	_, err = c.Do(ctx, http.MethodDelete, messageURL(webhookURL, messageID), "", nil)
+	return err
+}
+
+// IsNotFound reports whether err is a 404 from Discord, e.g. because the
+// message was deleted in the channel.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// messageURL returns /webhooks/{id}/{token}/messages/{message_id}, keeping
+// any query string of webhookURL.
+func messageURL(webhookURL, messageID string) string {
+	base, query, _ := strings.Cut(webhookURL, "?")
+	u := strings.TrimRight(base, "/") + "/messages/" + url.PathEscape(messageID)
+	if query != "" {
+		u += "?" + query
+	}
+	return u
+}
+
+// WithQuery adds key=value to the query string of rawURL.
+func WithQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
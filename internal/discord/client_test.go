@@ -0,0 +1,328 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"jira-discord-webhook/internal/metrics"
+)
+
+func testClient() *Client {
+	c := NewClient()
+	c.BaseDelay = time.Millisecond
+	c.MaxDelay = 50 * time.Millisecond
+	return c
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	retries := testutil.ToFloat64(metrics.DiscordRetries)
+	unavailable := testutil.ToFloat64(metrics.DiscordRequests.WithLabelValues(http.MethodPost, "503"))
+	if err := testClient().Send(context.Background(), srv.URL, WebhookMessage{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+	if d := testutil.ToFloat64(metrics.DiscordRetries) - retries; d != 2 {
+		t.Errorf("expected 2 retries counted, got %v", d)
+	}
+	if d := testutil.ToFloat64(metrics.DiscordRequests.WithLabelValues(http.MethodPost, "503")) - unavailable; d != 2 {
+		t.Errorf("expected 2 responses with status 503 counted, got %v", d)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	c := testClient()
+	c.MaxRetries = 2
+	err := c.Send(context.Background(), srv.URL, WebhookMessage{})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	if err := testClient().Send(context.Background(), srv.URL, WebhookMessage{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected 1 attempt, got %d", calls.Load())
+	}
+}
+
+func TestClientHonoursRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var first time.Time
+	var waited time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "0.02")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.02,"global":false}`))
+			return
+		}
+		waited = time.Since(first)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	if err := testClient().Send(context.Background(), srv.URL, WebhookMessage{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if waited < 20*time.Millisecond {
+		t.Fatalf("expected to wait for Retry-After, waited %s", waited)
+	}
+}
+
+func TestClientRateLimitTooLong(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	err := testClient().Send(context.Background(), srv.URL, WebhookMessage{})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestClientPacesExhaustedBucket(t *testing.T) {
+	var last time.Time
+	var gap time.Duration
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			gap = time.Since(last)
+		}
+		last = time.Now()
+		w.Header().Set("X-RateLimit-Bucket", "abc")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset-After", "0.03")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	c := testClient()
+	for i := 0; i < 2; i++ {
+		if err := c.Send(context.Background(), srv.URL+"?wait=true", WebhookMessage{}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if gap < 25*time.Millisecond {
+		t.Fatalf("expected second request to wait for bucket reset, gap %s", gap)
+	}
+}
+
+func TestClientContextCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c := testClient()
+	c.BaseDelay = time.Second
+	c.MaxDelay = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Send(ctx, srv.URL, WebhookMessage{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestClientPostEditDelete(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"42","channel_id":"7"}`))
+		case http.MethodPatch:
+			if r.URL.Path == "/api/webhooks/1/tok/messages/gone" {
+				http.Error(w, `{"message":"Unknown Message","code":10008}`, http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"id":"42"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	c := testClient()
+	hook := srv.URL + "/api/webhooks/1/tok"
+
+	m, err := c.Post(context.Background(), hook, "", WebhookMessage{})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if m.ID != "42" || m.ChannelID != "7" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+	if _, err := c.Post(context.Background(), hook, "99", WebhookMessage{}); err != nil {
+		t.Fatalf("Post to thread: %v", err)
+	}
+	if err := c.Edit(context.Background(), hook, "42", WebhookMessage{}); err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if err := c.Edit(context.Background(), hook, "gone", WebhookMessage{}); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := c.Delete(context.Background(), hook, "42"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	want := []string{
+		"POST /api/webhooks/1/tok?wait=true",
+		"POST /api/webhooks/1/tok?thread_id=99&wait=true",
+		"PATCH /api/webhooks/1/tok/messages/42",
+		"PATCH /api/webhooks/1/tok/messages/gone",
+		"DELETE /api/webhooks/1/tok/messages/42",
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("requests: got %v, want %v", requests, want)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Fatalf("requests: got %v, want %v", requests, want)
+		}
+	}
+}
+
+func TestClientUploadsFiles(t *testing.T) {
+	type upload struct {
+		payload WebhookMessage
+		name    string
+		data    string
+	}
+	got := make(chan upload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm: %v", err)
+			return
+		}
+		var u upload
+		json.Unmarshal([]byte(r.FormValue("payload_json")), &u.payload)
+		f, h, err := r.FormFile("files[0]")
+		if err != nil {
+			t.Errorf("FormFile: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		u.name, u.data = h.Filename, string(b)
+		got <- u
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	msg := WebhookMessage{
+		Embeds: []Embed{{Title: "PRJ-1", Image: &Image{URL: "attachment://shot.png"}}},
+		Files:  []File{{Name: "shot.png", ContentType: "image/png", Data: []byte("png")}},
+	}
+	if err := testClient().Send(context.Background(), srv.URL, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	u := <-got
+	if u.name != "shot.png" || u.data != "png" {
+		t.Errorf("unexpected file %q: %q", u.name, u.data)
+	}
+	if len(u.payload.Attachments) != 1 || u.payload.Attachments[0].Filename != "shot.png" || u.payload.Embeds[0].Image.URL != "attachment://shot.png" {
+		t.Errorf("unexpected payload: %+v", u.payload)
+	}
+}
+
+func TestClientDefaultWebhookURL(t *testing.T) {
+	var body WebhookMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := testClient()
+	if err := c.Send(context.Background(), "", WebhookMessage{Username: "bot"}); !errors.Is(err, ErrNoWebhookURL) {
+		t.Fatalf("expected ErrNoWebhookURL, got %v", err)
+	}
+	c.WebhookURL = srv.URL
+	if err := c.Send(context.Background(), "", WebhookMessage{Username: "bot"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if body.Username != "bot" {
+		t.Fatalf("expected username 'bot', got %q", body.Username)
+	}
+}
+
+func TestClientAbort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0.04")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	c := testClient()
+	c.MaxRetries = 1000
+	done := make(chan error, 1)
+	go func() { done <- c.Send(context.Background(), srv.URL, WebhookMessage{}) }()
+	time.Sleep(20 * time.Millisecond)
+	c.Abort()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Abort did not stop the request")
+	}
+	if err := c.Send(context.Background(), srv.URL, WebhookMessage{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("requests after Abort should fail, got %v", err)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	err := &url.Error{Op: "Post", URL: "https://discord.com/api/webhooks/123/SECRET-TOKEN?wait=true", Err: context.Canceled}
+	got := RedactError(err)
+	if want := `Post "https://discord.com/api/webhooks/REDACTED?wait=true": context canceled`; got.Error() != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if !errors.Is(got, context.Canceled) {
+		t.Fatal("redacted error should still wrap the cause")
+	}
+	var ue *url.Error
+	if !errors.As(got, &ue) {
+		t.Fatal("redacted error should still match *url.Error")
+	}
+	plain := errors.New("discord down")
+	if RedactError(plain) != plain || RedactError(nil) != nil {
+		t.Fatal("errors without webhook URLs should be returned unchanged")
+	}
+}
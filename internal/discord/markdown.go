@@ -0,0 +1,184 @@
+package discord
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Truncate shortens the Discord markdown s to at most max characters,
+// counted in Unicode code points as Discord does. The cut falls between
+// words and never inside a link, mention or URL; code blocks and
+// formatting left open by the cut are closed. A shortened text ends with
+// "…" and, when moreURL is set and there is room, a "Read more" link.
+func Truncate(s string, max int, moreURL string) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	suffix := "…"
+	if moreURL != "" {
+		suffix += " [Read more](" + moreURL + ")"
+	}
+	room := max - utf8.RuneCountInString(suffix)
+	if room <= 0 {
+		suffix, room = "…", max-1
+	}
+	if room <= 0 {
+		return string([]rune(s)[:max])
+	}
+	head, _ := cutMarkdown(s, room)
+	if strings.HasSuffix(head, "```") {
+		// Keep the ellipsis off the closing fence line.
+		if head, _ = cutMarkdown(s, room-1); strings.HasSuffix(head, "```") {
+			head += "\n"
+		}
+	}
+	return head + suffix
+}
+
+// atomicSpans matches the spans a cut must not fall into: markdown links,
+// mentions, channels, custom emoji and timestamps in angle brackets, and
+// bare URLs.
+var atomicSpans = regexp.MustCompile(`\[[^\]\n]*\]\([^)\s]*\)|<[^<>\s]+>|https?://\S+`)
+
+// cutMarkdown splits s so that head, together with the markers closing the
+// formatting still open at the cut, has at most max characters. tail
+// starts with the markers that reopen that formatting, so both halves
+// render as they would have in s.
+func cutMarkdown(s string, max int) (head, tail string) {
+	if utf8.RuneCountInString(s) <= max {
+		return s, ""
+	}
+	for limit := max; limit > 0; {
+		i, skip := cutIndex(s, limit)
+		if i == 0 {
+			break
+		}
+		head := strings.TrimRightFunc(s[:i], unicode.IsSpace)
+		closers, reopen := openMarkdown(head)
+		n := utf8.RuneCountInString(head) + utf8.RuneCountInString(closers)
+		if n <= max {
+			return head + closers, reopen + s[i+skip:]
+		}
+		limit -= n - max
+	}
+	r := []rune(s)
+	return string(r[:max]), string(r[max:])
+}
+
+// cutIndex returns the byte offset at which to cut s so that the head has
+// at most limit characters, and the length of the separator to drop
+// there. It prefers the end of a line and then a space in the second half
+// of the window, and moves back out of atomic spans and formatting markers.
+func cutIndex(s string, limit int) (int, int) {
+	b := len(s)
+	if r := []rune(s); len(r) > limit {
+		b = len(string(r[:limit]))
+	}
+	spans := atomicSpans.FindAllStringIndex(s, -1)
+	inside := func(i int) int {
+		for _, sp := range spans {
+			if sp[0] < i && i < sp[1] {
+				return sp[0]
+			}
+		}
+		return -1
+	}
+	if start := inside(b); start >= 0 {
+		b = start
+	}
+	// A separator right after the window ends a word within it.
+	window := s[:b]
+	if b < len(s) {
+		window = s[:b+1]
+	}
+	for _, sep := range []string{"\n", " "} {
+		for j := strings.LastIndex(window, sep); j >= len(window)/2 && j > 0; j = strings.LastIndex(window[:j], sep) {
+			if inside(j) < 0 {
+				return j, len(sep)
+			}
+		}
+	}
+	for b > 0 && strings.IndexByte("*_~|`", s[b-1]) >= 0 {
+		b--
+	}
+	return b, 0
+}
+
+// inlineMarkers are Discord's emphasis markers, longest first.
+var inlineMarkers = []string{"**", "__", "~~", "||", "*", "_"}
+
+// openMarkdown returns the markers that close the code block, inline code
+// and emphasis still open at the end of s, and those that reopen them.
+func openMarkdown(s string) (closers, reopen string) {
+	fence, code := "", false
+	var stack []string
+	for _, line := range strings.Split(s, "\n") {
+		if !code && strings.Count(line, "```")%2 == 1 {
+			if fence == "" {
+				fence = strings.TrimSpace(line)
+			} else {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" || strings.Contains(line, "```") {
+			continue
+		}
+		for i := 0; i < len(line); {
+			switch c := line[i]; {
+			case c == '\\':
+				i += 2
+				continue
+			case c == '`':
+				code = !code
+				i++
+				continue
+			case code:
+				i++
+				continue
+			}
+			m := ""
+			for _, mk := range inlineMarkers {
+				if strings.HasPrefix(line[i:], mk) {
+					m = mk
+					break
+				}
+			}
+			if m == "" {
+				i++
+				continue
+			}
+			prev, _ := utf8.DecodeLastRuneInString(line[:i])
+			next, _ := utf8.DecodeRuneInString(line[i+len(m):])
+			k := len(stack) - 1
+			for k >= 0 && stack[k] != m {
+				k--
+			}
+			switch {
+			case k >= 0 && i > 0 && !unicode.IsSpace(prev):
+				stack = append(stack[:k], stack[k+1:]...)
+			case i+len(m) < len(line) && !unicode.IsSpace(next) &&
+				!(m == "_" && i > 0 && isWordRune(prev) && isWordRune(next)):
+				stack = append(stack, m)
+			}
+			i += len(m)
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		closers += stack[i]
+	}
+	reopen = strings.Join(stack, "")
+	if code {
+		closers, reopen = "`"+closers, reopen+"`"
+	}
+	if fence != "" {
+		closers, reopen = "\n```"+closers, reopen+fence+"\n"
+	}
+	return closers, reopen
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
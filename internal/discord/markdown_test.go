@@ -0,0 +1,56 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	const more = "https://jira.example.com/browse/PRJ-1"
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		more string
+		want string
+	}{
+		{"short", "hello", 10, more, "hello"},
+		{"runes", "日本語のテキストです", 6, "", "日本語のテ…"},
+		{"words", "one two three four", 14, "", "one two three…"},
+		{"bold", "some **bold words here**", 20, "", "some **bold words**…"},
+		{"inline code", "run `make all now` please", 16, "", "run `make all`…"},
+		{"link", "see [the docs](https://example.com/docs) now", 30, "", "see…"},
+		{"mention", "ping <@123456789> now", 12, "", "ping…"},
+		{"snake case", "the some_value_name is long", 20, "", "the some_value_name…"},
+		{"fence", "```go\nfunc a() {}\nfunc b() {}\nfunc c() {}\n```", 36, "", "```go\nfunc a() {}\nfunc b() {}\n```\n…"},
+		{"read more", strings.Repeat("word ", 40), 60, "https://x.io/PRJ-1", "word word word word word…" + " [Read more](https://x.io/PRJ-1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.in, tt.max, tt.more)
+			if got != tt.want {
+				t.Errorf("Truncate = %q, want %q", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.max {
+				t.Errorf("result has %d characters, max %d", n, tt.max)
+			}
+		})
+	}
+}
+
+func TestCutMarkdownReopens(t *testing.T) {
+	s := "```js\n" + strings.Repeat("let x = 1;\n", 10) + "```"
+	head, tail := cutMarkdown(s, 60)
+	if !strings.HasSuffix(head, "\n```") || !strings.HasPrefix(tail, "```js\n") {
+		t.Fatalf("code block not closed and reopened:\n%s\n---\n%s", head, tail)
+	}
+	if utf8.RuneCountInString(head) > 60 {
+		t.Fatalf("head has %d characters", utf8.RuneCountInString(head))
+	}
+
+	head, tail = cutMarkdown("**"+strings.Repeat("bold ", 10)+"**", 20)
+	if !strings.HasSuffix(head, "**") || !strings.HasPrefix(tail, "**") {
+		t.Fatalf("bold not closed and reopened: %q / %q", head, tail)
+	}
+}
@@ -1,35 +0,0 @@
-package discord
-
-import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"os"
-)
-
-// SendFunc allows tests to replace the default sender.
-var SendFunc = SendWebhook
-
-// SendWebhook posts the given message to the Discord webhook URL.
-func SendWebhook(msg WebhookMessage) error {
-	webhookURL := os.Getenv("DISCORD_WEBHOOK_URL")
-	if webhookURL == "" {
-		return fmt.Errorf("DISCORD_WEBHOOK_URL not set")
-	}
-	b, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(b))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("discord webhook returned status %d: %s", resp.StatusCode, string(body))
-	}
-	return nil
-}
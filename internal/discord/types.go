@@ -4,15 +4,77 @@ package discord
 type WebhookMessage struct {
 	Username string  `json:"username,omitempty"`
 	Embeds   []Embed `json:"embeds"`
+	// ThreadName creates a new post with this name in a forum channel.
+	ThreadName string `json:"thread_name,omitempty"`
+	// Attachments describes Files; it is filled in when the message is
+	// sent.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Files are uploaded with the message as multipart form data.
+	Files []File `json:"-"`
+}
+
+// Attachment refers to an uploaded file by its index in Files.
+type Attachment struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// File is uploaded with a message. Embeds can show an uploaded image with
+// the URL "attachment://" + Name.
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
 
 // Embed represents a Discord embed.
 type Embed struct {
-	Title       string  `json:"title"`
-	URL         string  `json:"url,omitempty"`
-	Description string  `json:"description,omitempty"`
-	Color       int     `json:"color,omitempty"`
-	Fields      []Field `json:"fields,omitempty"`
+	Title       string `json:"title"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color,omitempty"`
+	// Timestamp is shown next to the footer; it must be ISO 8601, e.g.
+	// 2025-06-03T10:00:00Z.
+	Timestamp string     `json:"timestamp,omitempty"`
+	Fields    []Field    `json:"fields,omitempty"`
+	Author    *Author    `json:"author,omitempty"`
+	Footer    *Footer    `json:"footer,omitempty"`
+	Image     *Image     `json:"image,omitempty"`
+	Thumbnail *Thumbnail `json:"thumbnail,omitempty"`
+	Provider  *Provider  `json:"provider,omitempty"`
+}
+
+// Author is shown above an embed's title.
+type Author struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+// Footer is shown below an embed's fields.
+type Footer struct {
+	Text    string `json:"text"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+// Image is shown below an embed's fields.
+type Image struct {
+	URL    string `json:"url"`
+	Height int    `json:"height,omitempty"`
+	Width  int    `json:"width,omitempty"`
+}
+
+// Thumbnail is shown in the top right corner of an embed.
+type Thumbnail struct {
+	URL    string `json:"url"`
+	Height int    `json:"height,omitempty"`
+	Width  int    `json:"width,omitempty"`
+}
+
+// Provider names the site an embed comes from.
+type Provider struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
 }
 
 // Field represents an embed field.
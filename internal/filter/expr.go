@@ -0,0 +1,345 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"jira-discord-webhook/internal/jira"
+)
+
+// predicate reports whether a webhook satisfies a compiled expression.
+type predicate func(w jira.Webhook) bool
+
+// fieldValues extracts the values an expression field compares against.
+// Single-valued fields return one value, which may be empty.
+var fieldValues = map[string]func(w jira.Webhook) []string{
+	"event":     func(w jira.Webhook) []string { return []string{string(w.Event())} },
+	"project":   func(w jira.Webhook) []string { return []string{w.Issue.Fields.Project.Key} },
+	"issuetype": func(w jira.Webhook) []string { return []string{w.Issue.Fields.Issuetype.Name} },
+	"priority":  func(w jira.Webhook) []string { return []string{w.Issue.Fields.Priority.Name} },
+	"status":    func(w jira.Webhook) []string { return []string{w.Issue.Fields.Status.Name} },
+	"assignee":  func(w jira.Webhook) []string { return []string{w.Issue.Fields.Assignee.DisplayName} },
+	"summary":   func(w jira.Webhook) []string { return []string{w.Issue.Fields.Summary} },
+	"actor":     actors,
+	"labels":    func(w jira.Webhook) []string { return w.Issue.Fields.Labels },
+	"components": func(w jira.Webhook) []string {
+		var names []string
+		for _, c := range w.Issue.Fields.Components {
+			names = append(names, c.Name)
+		}
+		return names
+	},
+	"changed": changedFields,
+}
+
+// fieldAliases maps alternative JQL spellings to fieldValues keys.
+var fieldAliases = map[string]string{
+	"type":      "issuetype",
+	"label":     "labels",
+	"component": "components",
+}
+
+// compile parses a JQL-like expression such as
+//
+//	project = OPS AND (priority in (High, Highest) OR labels = incident)
+//
+// Conditions compare a field with "=", "!=", "~" (contains), "!~", "in",
+// "not in", "is empty" or "is not empty" and are combined with AND, OR, NOT
+// and parentheses. Comparisons are case-insensitive; multi-valued fields
+// (labels, components, changed) match when any of their values does.
+func compile(src string) (predicate, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	pred, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.peek().text, p.peek().pos)
+	}
+	return pred, nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case r == ',':
+			toks = append(toks, token{tokComma, ",", i})
+			i++
+		case r == '=' || r == '~':
+			toks = append(toks, token{tokOp, string(r), i})
+			i++
+		case r == '!':
+			if i+1 >= len(rs) || (rs[i+1] != '=' && rs[i+1] != '~') {
+				return nil, fmt.Errorf("unexpected '!' at offset %d", i)
+			}
+			toks = append(toks, token{tokOp, string(rs[i : i+2]), i})
+			i += 2
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			for i++; i < len(rs) && rs[i] != r; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				b.WriteRune(rs[i])
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), start})
+		case isWordRune(r):
+			start := i
+			for i < len(rs) && isWordRune(rs[i]) {
+				i++
+			}
+			toks = append(toks, token{tokWord, string(rs[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", r, i)
+		}
+	}
+	return toks, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.toks) }
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: -1, text: "end of expression"}
+	}
+	return p.toks[p.pos]
+}
+
+// keyword consumes the next token if it is the case-insensitive word kw.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.peek()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s, got %q", what, t.text)
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *parser) or() (predicate, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(w jira.Webhook) bool { return l(w) || right(w) }
+	}
+	return left, nil
+}
+
+func (p *parser) and() (predicate, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(w jira.Webhook) bool { return l(w) && right(w) }
+	}
+	return left, nil
+}
+
+func (p *parser) not() (predicate, error) {
+	if p.keyword("not") {
+		inner, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(w jira.Webhook) bool { return !inner(w) }, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return p.condition()
+}
+
+func (p *parser) condition() (predicate, error) {
+	t, err := p.expect(tokWord, "field name")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(t.text)
+	if alias, ok := fieldAliases[name]; ok {
+		name = alias
+	}
+	values, ok := fieldValues[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", t.text)
+	}
+
+	switch {
+	case p.keyword("is"):
+		negate := p.keyword("not")
+		if !p.keyword("empty") && !p.keyword("null") {
+			return nil, fmt.Errorf("expected EMPTY after IS, got %q", p.peek().text)
+		}
+		return func(w jira.Webhook) bool { return isEmpty(values(w)) != negate }, nil
+	case p.keyword("in"):
+		list, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return func(w jira.Webhook) bool { return anyEqual(values(w), list) }, nil
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return nil, fmt.Errorf("expected IN after NOT, got %q", p.peek().text)
+		}
+		list, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return func(w jira.Webhook) bool { return !anyEqual(values(w), list) }, nil
+	}
+
+	op, err := p.expect(tokOp, "operator")
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	want := []string{v}
+	switch op.text {
+	case "=":
+		return func(w jira.Webhook) bool { return anyEqual(values(w), want) }, nil
+	case "!=":
+		return func(w jira.Webhook) bool { return !anyEqual(values(w), want) }, nil
+	case "~":
+		return func(w jira.Webhook) bool { return anyContains(values(w), v) }, nil
+	default: // "!~"
+		return func(w jira.Webhook) bool { return !anyContains(values(w), v) }, nil
+	}
+}
+
+func (p *parser) value() (string, error) {
+	t := p.peek()
+	if t.kind != tokWord && t.kind != tokString {
+		return "", fmt.Errorf("expected value, got %q", t.text)
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) list() ([]string, error) {
+	if _, err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+	var list []string
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.pos++
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func isEmpty(have []string) bool {
+	for _, h := range have {
+		if h != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func anyEqual(have, want []string) bool {
+	for _, h := range have {
+		for _, w := range want {
+			if strings.EqualFold(h, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyContains(have []string, sub string) bool {
+	sub = strings.ToLower(sub)
+	for _, h := range have {
+		if strings.Contains(strings.ToLower(h), sub) {
+			return true
+		}
+	}
+	return false
+}
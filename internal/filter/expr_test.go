@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"testing"
+
+	"jira-discord-webhook/internal/jira"
+)
+
+func TestCompile(t *testing.T) {
+	w := update("OPS", "High", "status", "Sprint")
+	w.Issue.Fields.Summary = "Database outage in eu-west"
+	w.Issue.Fields.Status.Name = "In Progress"
+	w.Issue.Fields.Issuetype.Name = "Bug"
+	w.Issue.Fields.Labels = []string{"incident", "db"}
+	w.Issue.Fields.Components = []struct {
+		Name string `json:"name"`
+	}{{Name: "Backend"}}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`project = ops`, true},
+		{`project != OPS`, false},
+		{`status = "In Progress"`, true},
+		{`status = 'in progress' AND type = bug`, true},
+		{`priority in (Low, Medium)`, false},
+		{`priority NOT IN (Low, Medium)`, true},
+		{`labels = incident`, true},
+		{`labels != incident`, false},
+		{`label in (outage, db)`, true},
+		{`component = backend`, true},
+		{`summary ~ outage`, true},
+		{`summary !~ OUTAGE`, false},
+		{`assignee is empty`, true},
+		{`assignee is not empty`, false},
+		{`changed = sprint`, true},
+		{`changed = Sprint and not changed = status`, false},
+		{`event = issue_updated`, true},
+		{`actor = alice OR actor = acc-2`, true},
+		{`actor = acc-1`, true},
+		{`project = BE OR project = OPS AND priority = Low`, false},
+		{`(project = BE OR project = OPS) AND priority = High`, true},
+		{`NOT (labels = db)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			pred, err := compile(tt.expr)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if got := pred(w); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`project`,
+		`project =`,
+		`project = OPS AND`,
+		`(project = OPS`,
+		`project = OPS)`,
+		`project in OPS`,
+		`project in (OPS,)`,
+		`project not OPS`,
+		`project is OPS`,
+		`project ! OPS`,
+		`project = "OPS`,
+		`sprint = 1`,
+		`project = OPS $`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := compile(expr); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestCompileEmptyWebhook(t *testing.T) {
+	pred, err := compile(`actor is empty`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !pred(jira.Webhook{}) {
+		t.Fatal("expected empty actor")
+	}
+}
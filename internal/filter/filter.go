@@ -0,0 +1,192 @@
+package filter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"jira-discord-webhook/internal/jira"
+)
+
+// Rule matches Jira webhooks. Every condition that is set must hold; empty
+// lists match anything and comparisons are case-insensitive.
+type Rule struct {
+	Name string `yaml:"name"`
+	// Events lists jira.Event values such as issue_updated.
+	Events     []string `yaml:"events"`
+	Projects   []string `yaml:"projects"`
+	IssueTypes []string `yaml:"issue_types"`
+	Labels     []string `yaml:"labels"`
+	Components []string `yaml:"components"`
+	// Actors lists display names or account IDs of the user who caused
+	// the event.
+	Actors []string `yaml:"actors"`
+	// Fields matches when any of the listed fields is in the changelog.
+	Fields []string `yaml:"fields"`
+	// Expr is a JQL-like expression, e.g. `priority in (High, Highest)`.
+	Expr string `yaml:"expr"`
+
+	expr predicate
+}
+
+// Config is the YAML filter configuration.
+type Config struct {
+	// IgnoreFields are removed from changelogs before anything else is
+	// evaluated. An update that only changed ignored fields is dropped.
+	IgnoreFields []string `yaml:"ignore_fields"`
+	// Include, when not empty, drops events matching none of its rules.
+	Include []Rule `yaml:"include"`
+	// Exclude drops events matching any of its rules.
+	Exclude []Rule `yaml:"exclude"`
+}
+
+// Filter decides which Jira webhooks are forwarded to Discord.
+type Filter struct {
+	cfg    Config
+	ignore map[string]bool
+}
+
+// Load reads and validates the filter configuration at path.
+func Load(path string) (*Filter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse validates a YAML filter configuration.
+func Parse(b []byte) (*Filter, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// New validates cfg and returns a filter for it.
+func New(cfg Config) (*Filter, error) {
+	f := &Filter{ignore: make(map[string]bool)}
+	for _, name := range cfg.IgnoreFields {
+		f.ignore[strings.ToLower(name)] = true
+	}
+	if err := compileRules("include", cfg.Include); err != nil {
+		return nil, err
+	}
+	if err := compileRules("exclude", cfg.Exclude); err != nil {
+		return nil, err
+	}
+	f.cfg = cfg
+	return f, nil
+}
+
+func compileRules(section string, rules []Rule) error {
+	for i := range rules {
+		r := &rules[i]
+		if r.empty() {
+			return fmt.Errorf("%s rule %d (%s): no conditions", section, i, r.Name)
+		}
+		if r.Expr == "" {
+			continue
+		}
+		pred, err := compile(r.Expr)
+		if err != nil {
+			return fmt.Errorf("%s rule %d (%s): expr: %w", section, i, r.Name, err)
+		}
+		r.expr = pred
+	}
+	return nil
+}
+
+// Apply removes ignored fields from w's changelog and reports whether the
+// event should be forwarded. When it should not, reason says why.
+func (f *Filter) Apply(w *jira.Webhook) (keep bool, reason string) {
+	if w.Changelog != nil && len(f.ignore) > 0 {
+		items := make([]jira.ChangelogItem, 0, len(w.Changelog.Items))
+		var ignored []string
+		for _, it := range w.Changelog.Items {
+			if f.ignore[strings.ToLower(it.Field)] {
+				ignored = append(ignored, it.Field)
+				continue
+			}
+			items = append(items, it)
+		}
+		if len(ignored) > 0 {
+			cl := *w.Changelog
+			cl.Items = items
+			w.Changelog = &cl
+			if len(items) == 0 && w.Comment == nil && isUpdate(w.Event()) {
+				return false, "only ignored fields changed: " + strings.Join(ignored, ", ")
+			}
+		}
+	}
+	for i, r := range f.cfg.Exclude {
+		if r.matches(*w) {
+			if r.Name != "" {
+				return false, "excluded by rule " + r.Name
+			}
+			return false, fmt.Sprintf("excluded by rule %d", i)
+		}
+	}
+	if len(f.cfg.Include) == 0 {
+		return true, ""
+	}
+	for _, r := range f.cfg.Include {
+		if r.matches(*w) {
+			return true, ""
+		}
+	}
+	return false, "no include rule matched"
+}
+
+func isUpdate(ev jira.Event) bool {
+	return ev == jira.EventIssueUpdated || ev == jira.EventIssueGeneric
+}
+
+func (r Rule) empty() bool {
+	return len(r.Events) == 0 && len(r.Projects) == 0 && len(r.IssueTypes) == 0 &&
+		len(r.Labels) == 0 && len(r.Components) == 0 && len(r.Actors) == 0 &&
+		len(r.Fields) == 0 && r.Expr == ""
+}
+
+func (r Rule) matches(w jira.Webhook) bool {
+	f := w.Issue.Fields
+	return matchAny(r.Events, []string{string(w.Event())}) &&
+		matchAny(r.Projects, []string{f.Project.Key}) &&
+		matchAny(r.IssueTypes, []string{f.Issuetype.Name}) &&
+		matchAny(r.Labels, f.Labels) &&
+		matchAny(r.Components, fieldValues["components"](w)) &&
+		matchAny(r.Actors, actors(w)) &&
+		matchAny(r.Fields, changedFields(w)) &&
+		(r.expr == nil || r.expr(w))
+}
+
+// matchAny reports whether any of have is in want. An empty want matches
+// anything.
+func matchAny(want, have []string) bool {
+	return len(want) == 0 || anyEqual(have, want)
+}
+
+// actors returns the display name and account ID of the user who caused
+// the event.
+func actors(w jira.Webhook) []string {
+	a := []string{w.Actor()}
+	if w.User != nil && w.User.AccountID != "" {
+		a = append(a, w.User.AccountID)
+	}
+	return a
+}
+
+// changedFields returns the field names in w's changelog.
+func changedFields(w jira.Webhook) []string {
+	if w.Changelog == nil {
+		return nil
+	}
+	names := make([]string, 0, len(w.Changelog.Items))
+	for _, it := range w.Changelog.Items {
+		names = append(names, it.Field)
+	}
+	return names
+}
@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"jira-discord-webhook/internal/jira"
+)
+
+const testConfig = `ignore_fields: [Rank, Sprint, timeestimate]
+exclude:
+  - name: bots
+    actors: [Automation for Jira]
+  - events: [comment_deleted]
+include:
+  - projects: [OPS]
+  - expr: priority in (High, Highest) AND labels != wontfix
+`
+
+func update(project, priority string, fields ...string) jira.Webhook {
+	var w jira.Webhook
+	w.WebhookEvent = "jira:issue_updated"
+	w.Issue.Key = project + "-1"
+	w.Issue.Fields.Project.Key = project
+	w.Issue.Fields.Priority.Name = priority
+	w.User = &jira.User{DisplayName: "Alice", AccountID: "acc-1"}
+	w.Changelog = &jira.Changelog{}
+	for _, f := range fields {
+		w.Changelog.Items = append(w.Changelog.Items, jira.ChangelogItem{Field: f})
+	}
+	return w
+}
+
+func TestApply(t *testing.T) {
+	f, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	bot := update("OPS", "Low", "status")
+	bot.User.DisplayName = "automation for jira"
+	wontfix := update("BE", "High", "status")
+	wontfix.Issue.Fields.Labels = []string{"WontFix"}
+	deleted := update("OPS", "Low")
+	deleted.WebhookEvent = "comment_deleted"
+	deleted.Comment = &jira.Comment{ID: "1"}
+
+	tests := []struct {
+		name   string
+		w      jira.Webhook
+		keep   bool
+		reason string
+	}{
+		{"included project", update("OPS", "Low", "status"), true, ""},
+		{"included expr", update("BE", "highest", "status"), true, ""},
+		{"not included", update("BE", "Low", "status"), false, "no include rule matched"},
+		{"only ignored", update("OPS", "Low", "Rank", "sprint"), false, "only ignored fields changed: Rank, sprint"},
+		{"partly ignored", update("OPS", "Low", "Rank", "status"), true, ""},
+		{"excluded actor", bot, false, "excluded by rule bots"},
+		{"excluded event", deleted, false, "excluded by rule 1"},
+		{"expr negation", wontfix, false, "no include rule matched"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, reason := f.Apply(&tt.w)
+			if keep != tt.keep || reason != tt.reason {
+				t.Fatalf("Apply = %v, %q; want %v, %q", keep, reason, tt.keep, tt.reason)
+			}
+		})
+	}
+}
+
+func TestApplyStripsIgnoredFields(t *testing.T) {
+	f, err := New(Config{IgnoreFields: []string{"rank"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	w := update("OPS", "Low", "Rank", "status")
+	original := w.Changelog
+	if keep, _ := f.Apply(&w); !keep {
+		t.Fatal("expected event to be kept")
+	}
+	if len(w.Changelog.Items) != 1 || w.Changelog.Items[0].Field != "status" {
+		t.Fatalf("unexpected changelog: %+v", w.Changelog.Items)
+	}
+	if len(original.Items) != 2 {
+		t.Fatal("the original changelog should not be modified")
+	}
+}
+
+func TestApplyFieldsRule(t *testing.T) {
+	f, err := New(Config{Exclude: []Rule{{Fields: []string{"Flagged"}, Events: []string{"issue_updated"}}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if keep, _ := f.Apply(ptr(update("OPS", "Low", "status", "Flagged"))); keep {
+		t.Fatal("expected flagged change to be excluded")
+	}
+	if keep, _ := f.Apply(ptr(update("OPS", "Low", "status"))); !keep {
+		t.Fatal("expected status change to be kept")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"emptyRule": "exclude:\n  - name: everything\n",
+		"badExpr":   "include:\n  - expr: priority ==\n",
+		"badField":  "include:\n  - expr: sprint = 1\n",
+		"badYAML":   "include: [",
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(cfg)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := Load("does-not-exist.yaml"); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	path := filepath.Join(t.TempDir(), "filters.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+}
+
+func ptr(w jira.Webhook) *jira.Webhook { return &w }
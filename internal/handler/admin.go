@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/queue"
+)
+
+// RegisterAdmin adds the dead-letter endpoints to r. Callers are expected to
+// protect r with authentication middleware.
+func (h *WebhookHandler) RegisterAdmin(r fiber.Router) {
+	r.Get("/deadletters", h.ListDeadLetters)
+	r.Get("/deadletters/:id", h.GetDeadLetter)
+	r.Post("/deadletters/replay", h.ReplayDeadLetters)
+	r.Post("/deadletters/:id/replay", h.ReplayDeadLetter)
+	r.Delete("/deadletters", h.PurgeDeadLetters)
+	r.Delete("/deadletters/:id", h.DeleteDeadLetter)
+}
+
+// ListDeadLetters returns every dead letter as JSON.
+func (h *WebhookHandler) ListDeadLetters(c *fiber.Ctx) error {
+	letters, err := h.DeadLetters.List()
+	if err != nil {
+		zap.L().Error("failed to list dead letters", zap.Error(err))
+	}
+	if letters == nil {
+		letters = []queue.DeadLetter{}
+	}
+	return c.JSON(letters)
+}
+
+// GetDeadLetter returns a single dead letter as JSON.
+func (h *WebhookHandler) GetDeadLetter(c *fiber.Ctx) error {
+	l, err := h.DeadLetters.Get(c.Params("id"))
+	if err != nil {
+		return deadLetterError(c, err)
+	}
+	return c.JSON(l)
+}
+
+// ReplayDeadLetter re-delivers a dead letter and removes it on success.
+func (h *WebhookHandler) ReplayDeadLetter(c *fiber.Ctx) error {
+	l, err := h.DeadLetters.Get(c.Params("id"))
+	if err != nil {
+		return deadLetterError(c, err)
+	}
+	if err := discord.RedactError(h.replay(l)); err != nil {
+		zap.L().Error("failed to replay dead letter", zap.String("id", l.ID), zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"id": l.ID, "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"replayed": []string{l.ID}})
+}
+
+// ReplayDeadLetters re-delivers every dead letter and reports which failed.
+func (h *WebhookHandler) ReplayDeadLetters(c *fiber.Ctx) error {
+	letters, err := h.DeadLetters.List()
+	if err != nil {
+		zap.L().Error("failed to list dead letters", zap.Error(err))
+	}
+	replayed := []string{}
+	failed := fiber.Map{}
+	for _, l := range letters {
+		if err := discord.RedactError(h.replay(l)); err != nil {
+			failed[l.ID] = err.Error()
+			continue
+		}
+		replayed = append(replayed, l.ID)
+	}
+	status := fiber.StatusOK
+	if len(failed) > 0 {
+		status = fiber.StatusMultiStatus
+	}
+	return c.Status(status).JSON(fiber.Map{"replayed": replayed, "failed": failed})
+}
+
+// DeleteDeadLetter removes a single dead letter.
+func (h *WebhookHandler) DeleteDeadLetter(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.DeadLetters.Delete(id); err != nil {
+		return deadLetterError(c, err)
+	}
+	h.forgetProgress(id)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PurgeDeadLetters removes every dead letter.
+func (h *WebhookHandler) PurgeDeadLetters(c *fiber.Ctx) error {
+	letters, _ := h.DeadLetters.List()
+	for _, l := range letters {
+		h.forgetProgress(l.ID)
+	}
+	n, err := h.DeadLetters.Purge()
+	if err != nil {
+		zap.L().Error("failed to purge dead letters", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"purged": n, "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"purged": n})
+}
+
+// replay hands l back to the queue, or delivers it directly when there is no
+// queue. The dead letter is removed once it has been accepted. The job keeps
+// its ID, so that it resumes after the parts of a split message that were
+// already delivered.
+func (h *WebhookHandler) replay(l queue.DeadLetter) error {
+	job := l.Job
+	if h.Queue != nil {
+		job.Attempts = 0
+		job.LastError = ""
+		if err := h.Queue.Enqueue(job); err != nil {
+			return err
+		}
+	} else {
+		job.Attempts++
+		if err := h.deliver(job); err != nil {
+			if dlErr := h.DeadLetters.Add(job, err); dlErr != nil {
+				zap.L().Error("failed to update dead letter", zap.String("id", job.ID), zap.Error(dlErr))
+			}
+			return err
+		}
+	}
+	return h.DeadLetters.Delete(l.ID)
+}
+
+func deadLetterError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, queue.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString("not found")
+	}
+	zap.L().Error("dead letter store error", zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).SendString("internal error")
+}
+
+// forgetProgress drops the delivery progress of a discarded job.
+func (h *WebhookHandler) forgetProgress(id string) {
+	if h.Messages != nil {
+		h.setPartsSent(id, 0, 0)
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/routing"
+)
+
+func setupAdmin(t *testing.T, n *fakeNotifier) (*fiber.App, *WebhookHandler) {
+	t.Helper()
+	h := newHandler(n)
+	store, err := queue.OpenDeadLetters(t.TempDir())
+	require.NoError(t, err)
+	h.DeadLetters = store
+	app := fiber.New()
+	h.RegisterAdmin(app.Group("/admin"))
+	return app, h
+}
+
+func addLetter(t *testing.T, h *WebhookHandler, id string) {
+	t.Helper()
+	job := queue.Job{
+		ID:          id,
+		Destination: routing.Destination{Name: "general", URL: "https://discord.example.com/general"},
+		Message:     discord.WebhookMessage{Username: "Jira"},
+		Payload:     json.RawMessage(`{"issue":{"key":"PRJ-1"}}`),
+		Attempts:    5,
+		CreatedAt:   time.Now().UTC(),
+	}
+	require.NoError(t, h.DeadLetters.Add(job, errors.New("discord down")))
+}
+
+func TestAdminListAndGet(t *testing.T) {
+	app, h := setupAdmin(t, &fakeNotifier{})
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/deadletters", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var letters []queue.DeadLetter
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&letters))
+	require.Empty(t, letters)
+
+	addLetter(t, h, "0001")
+	resp, err = app.Test(httptest.NewRequest("GET", "/admin/deadletters", nil))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&letters))
+	require.Len(t, letters, 1)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/admin/deadletters/0001", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var l queue.DeadLetter
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&l))
+	require.Equal(t, "discord down", l.LastError)
+	require.JSONEq(t, `{"issue":{"key":"PRJ-1"}}`, string(l.Payload))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/admin/deadletters/missing", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestAdminReplay(t *testing.T) {
+	n := &fakeNotifier{}
+	app, h := setupAdmin(t, n)
+	fail := true
+	n.send = func(webhookURL string, msg discord.WebhookMessage) error {
+		if fail {
+			return &url.Error{Op: "Post", URL: "https://discord.com/api/webhooks/1/SECRET-TOKEN", Err: errors.New("still down")}
+		}
+		return nil
+	}
+
+	addLetter(t, h, "0001")
+	resp, err := app.Test(httptest.NewRequest("POST", "/admin/deadletters/0001/replay", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusBadGateway, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	require.NotContains(t, string(body), "SECRET-TOKEN")
+	l, err := h.DeadLetters.Get("0001")
+	require.NoError(t, err, "failed replay should keep the dead letter")
+	require.Equal(t, 6, l.Attempts)
+	require.Equal(t, `Post "https://discord.com/api/webhooks/REDACTED": still down`, l.LastError, "the webhook token must not be stored")
+
+	fail = false
+	resp, err = app.Test(httptest.NewRequest("POST", "/admin/deadletters/0001/replay", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	_, err = h.DeadLetters.Get("0001")
+	require.ErrorIs(t, err, queue.ErrNotFound)
+}
+
+func TestAdminReplayAllToQueue(t *testing.T) {
+	app, h := setupAdmin(t, &fakeNotifier{})
+	spool, err := queue.OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	// Not started: replayed jobs stay in the spool.
+	h.Queue = queue.New(spool, h.Deliver, queue.Options{Size: 10})
+
+	addLetter(t, h, "0001")
+	addLetter(t, h, "0002")
+	resp, err := app.Test(httptest.NewRequest("POST", "/admin/deadletters/replay", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var body struct {
+		Replayed []string `json:"replayed"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, []string{"0001", "0002"}, body.Replayed)
+
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, "0001", jobs[0].ID)
+	require.Zero(t, jobs[0].Attempts)
+	letters, err := h.DeadLetters.List()
+	require.NoError(t, err)
+	require.Empty(t, letters)
+}
+
+func TestAdminDeleteAndPurge(t *testing.T) {
+	app, h := setupAdmin(t, &fakeNotifier{})
+	addLetter(t, h, "0001")
+	addLetter(t, h, "0002")
+	addLetter(t, h, "0003")
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", "/admin/deadletters/0001", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+	resp, err = app.Test(httptest.NewRequest("DELETE", "/admin/deadletters/0001", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("DELETE", "/admin/deadletters", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var body struct {
+		Purged int `json:"purged"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, 2, body.Purged)
+}
+
+func TestWebhookHandlerSyncFailureDeadLettered(t *testing.T) {
+	n := &fakeNotifier{}
+	_, h := setupAdmin(t, n)
+	app := setupApp(h)
+	n.send = func(_ string, msg discord.WebhookMessage) error {
+		return errors.New("discord down")
+	}
+	b, _ := json.Marshal(map[string]any{"issue": map[string]any{"key": "PRJ-DL"}})
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+
+	letters, err := h.DeadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	require.Equal(t, "discord down", letters[0].LastError)
+	require.JSONEq(t, string(b), string(letters[0].Payload))
+}
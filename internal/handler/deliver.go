@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/jira"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/routing"
+)
+
+// Discord accepts at most 10 files and 25 MiB per webhook message.
+const (
+	maxFiles       = 10
+	maxUploadBytes = 25 << 20
+)
+
+// issueMessage is the state kept per destination and issue.
+type issueMessage struct {
+	MessageID string `json:"messageId,omitempty"`
+	ThreadID  string `json:"threadId,omitempty"`
+	// Comment holds the fields of the latest comment so that it stays
+	// visible when later events without a comment refresh the message.
+	Comment []discord.Field `json:"comment,omitempty"`
+}
+
+// Deliver sends a queued job to its destination. It is the delivery
+// function of Queue.
+func (h *WebhookHandler) Deliver(job queue.Job) error {
+	return h.deliver(job)
+}
+
+func (h *WebhookHandler) deliver(job queue.Job) (err error) {
+	d := job.Destination
+	defer func() {
+		// Transport errors carry the webhook URL and its token.
+		err = discord.RedactError(err)
+		h.recordDelivery(d.Name, err)
+	}()
+	if h.Attachments != nil && len(job.Attachments) > 0 {
+		job.Message = h.withAttachments(job)
+	}
+	switch {
+	case d.Mode == routing.ModeEdit && h.Messages != nil && job.IssueKey != "":
+		return h.deliverEdit(job)
+	case d.Mode == routing.ModeThread && h.Messages != nil && job.IssueKey != "":
+		return h.deliverThread(job)
+	default:
+		// An empty URL selects the notifier's default webhook.
+		return h.sendParts(job, discord.Split(job.Message), func(part discord.WebhookMessage) error {
+			return h.notifier.Send(context.Background(), d.URL, part)
+		})
+	}
+}
+
+// sendParts sends the parts of a split message in order. While parts remain,
+// the number already sent is kept in Messages, so that a retry of the job
+// resumes after them rather than posting them again.
+func (h *WebhookHandler) sendParts(job queue.Job, parts []discord.WebhookMessage, send func(discord.WebhookMessage) error) error {
+	track := h.Messages != nil && job.ID != "" && len(parts) > 1
+	sent := 0
+	if track {
+		h.Messages.Get(partsKey(job.ID), &sent)
+	}
+	for i := sent; i < len(parts); i++ {
+		if err := send(parts[i]); err != nil {
+			return err
+		}
+		if track {
+			h.setPartsSent(job.ID, i+1, len(parts))
+		}
+	}
+	return nil
+}
+
+// partsKey is the key of a job's delivery progress in Messages. Issue keys
+// always contain '|', so the two cannot collide.
+func partsKey(jobID string) string {
+	return "parts:" + jobID
+}
+
+// setPartsSent records that sent of total parts of a job were delivered,
+// forgetting the job when none or all of them were.
+func (h *WebhookHandler) setPartsSent(jobID string, sent, total int) {
+	var err error
+	if sent == 0 || sent >= total {
+		err = h.Messages.Delete(partsKey(jobID))
+	} else {
+		err = h.Messages.Set(partsKey(jobID), sent)
+	}
+	if err != nil {
+		// A lost count only means a retry posts the sent parts again.
+		zap.L().Error("failed to save delivery progress", zap.String("job", jobID), zap.Error(err))
+	}
+}
+
+// deliverEdit edits the message previously posted for the job's issue, or
+// posts one and remembers its ID. A message deleted in Discord is replaced.
+func (h *WebhookHandler) deliverEdit(job queue.Job) error {
+	d := job.Destination
+	key, unlock := h.lockIssue(job)
+	defer unlock()
+
+	var rec issueMessage
+	h.Messages.Get(key, &rec)
+
+	msg := job.Message
+	if comment := commentFields(msg); len(comment) > 0 {
+		rec.Comment = comment
+	} else {
+		msg = withComment(msg, rec.Comment)
+	}
+	// The tracked message is a single message; drop what does not fit.
+	msg = discord.Fit(msg)
+
+	posted := false
+	if rec.MessageID != "" {
+		err := h.notifier.Edit(context.Background(), d.URL, rec.MessageID, msg)
+		switch {
+		case err == nil:
+			posted = true
+		case discord.IsNotFound(err):
+			zap.L().Info("tracked Discord message is gone, posting a new one",
+				zap.String("issue", job.IssueKey), zap.String("destination", d.Name))
+		default:
+			return err
+		}
+	}
+	if !posted {
+		m, err := h.notifier.Post(context.Background(), d.URL, "", msg)
+		if err != nil {
+			return err
+		}
+		rec.MessageID = m.ID
+	}
+	h.saveIssueMessage(job, key, rec)
+	return nil
+}
+
+// maxThreadName is Discord's limit on channel names.
+const maxThreadName = 100
+
+// deliverThread posts the job into the thread created for its issue. The
+// first event for an issue creates the thread in the destination's forum
+// channel; a thread deleted in Discord is created again.
+func (h *WebhookHandler) deliverThread(job queue.Job) error {
+	d := job.Destination
+	key, unlock := h.lockIssue(job)
+	defer unlock()
+
+	var rec issueMessage
+	h.Messages.Get(key, &rec)
+
+	parts := discord.Split(job.Message)
+	post := func(part discord.WebhookMessage) error {
+		if rec.ThreadID != "" {
+			_, err := h.notifier.Post(context.Background(), d.URL, rec.ThreadID, part)
+			return err
+		}
+		part.ThreadName = threadName(job)
+		m, err := h.notifier.Post(context.Background(), d.URL, "", part)
+		if err != nil {
+			return err
+		}
+		rec.ThreadID = m.ChannelID
+		h.saveIssueMessage(job, key, rec)
+		return nil
+	}
+	err := h.sendParts(job, parts, post)
+	if err != nil && rec.ThreadID != "" && discord.IsNotFound(err) {
+		zap.L().Info("tracked Discord thread is gone, creating a new one",
+			zap.String("issue", job.IssueKey), zap.String("destination", d.Name))
+		rec.ThreadID = ""
+		h.setPartsSent(job.ID, 0, len(parts))
+		err = h.sendParts(job, parts, post)
+	}
+	if err != nil {
+		return err
+	}
+	h.saveIssueMessage(job, key, rec)
+	return nil
+}
+
+// threadName names an issue's thread "KEY: summary".
+func threadName(job queue.Job) string {
+	name := job.IssueKey
+	if job.Summary != "" {
+		name += ": " + job.Summary
+	}
+	if r := []rune(name); len(r) > maxThreadName {
+		name = string(r[:maxThreadName-1]) + "…"
+	}
+	return name
+}
+
+// issueLock is the lock of one destination and issue, counting the
+// deliveries holding or waiting for it.
+type issueLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockIssue serialises deliveries for the job's destination and issue and
+// returns the key of their state in Messages. The lock is dropped once no
+// delivery uses it, so that locks do not pile up for every issue seen.
+func (h *WebhookHandler) lockIssue(job queue.Job) (string, func()) {
+	key := job.Destination.Name + "|" + job.IssueKey
+	h.issueLocksMu.Lock()
+	if h.issueLocks == nil {
+		h.issueLocks = make(map[string]*issueLock)
+	}
+	lock := h.issueLocks[key]
+	if lock == nil {
+		lock = &issueLock{}
+		h.issueLocks[key] = lock
+	}
+	lock.refs++
+	h.issueLocksMu.Unlock()
+
+	lock.Lock()
+	return key, func() {
+		lock.Unlock()
+		h.issueLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(h.issueLocks, key)
+		}
+		h.issueLocksMu.Unlock()
+	}
+}
+
+// saveIssueMessage stores rec for the job's issue, or forgets the issue once
+// it has been deleted.
+func (h *WebhookHandler) saveIssueMessage(job queue.Job, key string, rec issueMessage) {
+	var err error
+	if job.Event == string(jira.EventIssueDeleted) {
+		err = h.Messages.Delete(key)
+	} else {
+		err = h.Messages.Set(key, rec)
+	}
+	if err != nil {
+		// The message was delivered; a lost mapping only means the next
+		// event posts a new message or thread.
+		zap.L().Error("failed to save Discord message mapping", zap.String("issue", job.IssueKey), zap.Error(err))
+	}
+}
+
+func isCommentField(name string) bool {
+	return name == "Comment" || name == "Comment (edited)" || name == "Comment by"
+}
+
+// commentFields returns the comment fields of the first embed in msg.
+func commentFields(msg discord.WebhookMessage) []discord.Field {
+	if len(msg.Embeds) == 0 {
+		return nil
+	}
+	var fields []discord.Field
+	for _, f := range msg.Embeds[0].Fields {
+		if isCommentField(f.Name) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// withComment returns msg with comment inserted before the issue's inline
+// fields (Priority, Assignee, ...) of the first embed.
+func withComment(msg discord.WebhookMessage, comment []discord.Field) discord.WebhookMessage {
+	if len(comment) == 0 || len(msg.Embeds) == 0 {
+		return msg
+	}
+	embeds := append([]discord.Embed(nil), msg.Embeds...)
+	old := embeds[0].Fields
+	at := len(old)
+	for i, f := range old {
+		if f.Name == "Priority" {
+			at = i
+			break
+		}
+	}
+	fields := make([]discord.Field, 0, len(old)+len(comment))
+	fields = append(fields, old[:at]...)
+	fields = append(fields, comment...)
+	fields = append(fields, old[at:]...)
+	embeds[0].Fields = fields
+	msg.Embeds = embeds
+	return msg
+}
+
+// withAttachments returns the job's message with its attachments as files
+// and the first image shown in the embed. Attachments that cannot be
+// downloaded are logged and left out rather than failing the delivery.
+func (h *WebhookHandler) withAttachments(job queue.Job) discord.WebhookMessage {
+	msg := job.Message
+	used := make(map[string]bool)
+	var total int
+	var image string
+	for _, a := range job.Attachments {
+		if len(msg.Files) == maxFiles {
+			break
+		}
+		data, err := h.Attachments.Download(context.Background(), a)
+		if err != nil {
+			zap.L().Warn("failed to download Jira attachment",
+				zap.String("issue", job.IssueKey), zap.String("file", a.Filename), zap.Error(err))
+			continue
+		}
+		if total+len(data) > maxUploadBytes {
+			zap.L().Warn("skipping Jira attachment over the upload limit",
+				zap.String("issue", job.IssueKey), zap.String("file", a.Filename))
+			continue
+		}
+		total += len(data)
+		name := uploadName(a.Filename, used)
+		msg.Files = append(msg.Files, discord.File{Name: name, ContentType: a.MimeType, Data: data})
+		if image == "" && a.IsImage() {
+			image = name
+		}
+	}
+	if image != "" && len(msg.Embeds) > 0 && msg.Embeds[0].Image == nil {
+		embeds := append([]discord.Embed(nil), msg.Embeds...)
+		embeds[0].Image = &discord.Image{URL: "attachment://" + image}
+		msg.Embeds = embeds
+	}
+	return msg
+}
+
+// uploadName returns a unique file name that attachment:// URLs accept,
+// replacing characters other than letters, digits, '-', '_' and '.'.
+func uploadName(filename string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, filename)
+	if name == "" {
+		name = "attachment"
+	}
+	base, ext := name, ""
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		base, ext = name[:i], name[i:]
+	}
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	used[name] = true
+	return name
+}
@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/jira"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/routing"
+	"jira-discord-webhook/internal/store"
+)
+
+// fakeDiscord records the webhook calls made by a handler.
+type fakeDiscord struct {
+	fakeNotifier
+	posts   []discord.WebhookMessage
+	threads []string
+	edits   map[string]discord.WebhookMessage
+	missing map[string]bool
+	nextID  int
+}
+
+func stubDiscord() (*WebhookHandler, *fakeDiscord) {
+	f := &fakeDiscord{edits: map[string]discord.WebhookMessage{}, missing: map[string]bool{}}
+	f.post = func(url, threadID string, msg discord.WebhookMessage) (*discord.Message, error) {
+		if f.missing[threadID] {
+			return nil, &discord.StatusError{StatusCode: 404, Body: "Unknown Channel"}
+		}
+		f.nextID++
+		f.posts = append(f.posts, msg)
+		f.threads = append(f.threads, threadID)
+		id := strconv.Itoa(f.nextID)
+		channel := threadID
+		if msg.ThreadName != "" {
+			channel = "thread-" + id
+		}
+		return &discord.Message{ID: id, ChannelID: channel}, nil
+	}
+	f.edit = func(url, id string, msg discord.WebhookMessage) error {
+		if f.missing[id] {
+			return &discord.StatusError{StatusCode: 404, Body: "Unknown Message"}
+		}
+		f.edits[id] = msg
+		return nil
+	}
+	return newHandler(f), f
+}
+
+func openMessages(t *testing.T, h *WebhookHandler) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "messages.json")
+	s, err := store.Open(path)
+	require.NoError(t, err)
+	h.Messages = s
+	return path
+}
+
+func editJob(ev jira.Event, fields ...discord.Field) queue.Job {
+	return queue.Job{
+		Destination: routing.Destination{Name: "general", URL: "https://discord.example.com/general", Mode: routing.ModeEdit},
+		IssueKey:    "PRJ-1",
+		Event:       string(ev),
+		Message:     discord.WebhookMessage{Embeds: []discord.Embed{{Title: "PRJ-1: Test", Fields: fields}}},
+	}
+}
+
+func TestDeliverEditMode(t *testing.T) {
+	h, f := stubDiscord()
+	path := openMessages(t, h)
+
+	priority := discord.Field{Name: "Priority", Value: "High", Inline: true}
+	require.NoError(t, h.deliver(editJob(jira.EventIssueCreated, priority)))
+	require.Len(t, f.posts, 1)
+
+	comment := []discord.Field{{Name: "Comment", Value: "hello"}, {Name: "Comment by", Value: "Alice", Inline: true}}
+	require.NoError(t, h.deliver(editJob(jira.EventCommentCreated, append(comment, priority)...)))
+	require.Len(t, f.posts, 1, "second event should edit")
+
+	// Later events keep showing the latest comment, and the mapping
+	// survives a restart.
+	s, err := store.Open(path)
+	require.NoError(t, err)
+	h.Messages = s
+	require.NoError(t, h.deliver(editJob(jira.EventIssueUpdated, discord.Field{Name: "Changes", Value: "Status: Open → Closed"}, priority)))
+	require.Len(t, f.posts, 1)
+	fields := f.edits["1"].Embeds[0].Fields
+	require.Equal(t, []string{"Changes", "Comment", "Comment by", "Priority"},
+		[]string{fields[0].Name, fields[1].Name, fields[2].Name, fields[3].Name})
+}
+
+func TestLockIssueReleasesUnusedLocks(t *testing.T) {
+	h := newHandler(&fakeNotifier{})
+	job := editJob(jira.EventIssueCreated)
+	_, unlock := h.lockIssue(job)
+	acquired := make(chan func())
+	go func() {
+		_, unlock := h.lockIssue(job)
+		acquired <- unlock
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a second delivery for the issue should wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	(<-acquired)()
+	require.Empty(t, h.issueLocks, "locks should be dropped once unused")
+}
+
+func TestDeliverEditModeMessageDeleted(t *testing.T) {
+	h, f := stubDiscord()
+	openMessages(t, h)
+	require.NoError(t, h.deliver(editJob(jira.EventIssueCreated)))
+	f.missing["1"] = true
+	require.NoError(t, h.deliver(editJob(jira.EventIssueUpdated)))
+	require.Len(t, f.posts, 2, "a deleted message should be replaced")
+
+	var rec issueMessage
+	require.True(t, h.Messages.Get("general|PRJ-1", &rec))
+	require.Equal(t, "2", rec.MessageID)
+
+	require.NoError(t, h.deliver(editJob(jira.EventIssueDeleted)))
+	require.False(t, h.Messages.Get("general|PRJ-1", &rec), "deleted issues should be forgotten")
+}
+
+func TestDeliverPostModeIgnoresMessages(t *testing.T) {
+	h, f := stubDiscord()
+	openMessages(t, h)
+	sent := 0
+	f.send = func(url string, msg discord.WebhookMessage) error {
+		sent++
+		return nil
+	}
+	job := editJob(jira.EventIssueCreated)
+	job.Destination.Mode = routing.ModePost
+	require.NoError(t, h.deliver(job))
+	require.NoError(t, h.deliver(job))
+	require.Equal(t, 2, sent)
+	require.Empty(t, f.posts)
+	require.Zero(t, h.Messages.Len())
+}
+
+func threadJob(ev jira.Event) queue.Job {
+	job := editJob(ev)
+	job.Destination.Mode = routing.ModeThread
+	job.Summary = "Test"
+	return job
+}
+
+func TestDeliverThreadMode(t *testing.T) {
+	h, f := stubDiscord()
+	path := openMessages(t, h)
+
+	require.NoError(t, h.deliver(threadJob(jira.EventIssueCreated)))
+	require.Equal(t, "PRJ-1: Test", f.posts[0].ThreadName)
+	require.Equal(t, "", f.threads[0])
+
+	// Follow-ups go into the thread, also after a restart.
+	s, err := store.Open(path)
+	require.NoError(t, err)
+	h.Messages = s
+	require.NoError(t, h.deliver(threadJob(jira.EventCommentCreated)))
+	require.NoError(t, h.deliver(threadJob(jira.EventIssueUpdated)))
+	require.Len(t, f.posts, 3)
+	require.Equal(t, []string{"", "thread-1", "thread-1"}, f.threads)
+	require.Empty(t, f.posts[1].ThreadName)
+}
+
+func TestDeliverThreadModeThreadDeleted(t *testing.T) {
+	h, f := stubDiscord()
+	openMessages(t, h)
+	require.NoError(t, h.deliver(threadJob(jira.EventIssueCreated)))
+	f.missing["thread-1"] = true
+	require.NoError(t, h.deliver(threadJob(jira.EventCommentCreated)))
+	require.Equal(t, []string{"", ""}, f.threads)
+	require.Equal(t, "PRJ-1: Test", f.posts[1].ThreadName)
+
+	var rec issueMessage
+	require.True(t, h.Messages.Get("general|PRJ-1", &rec))
+	require.Equal(t, "thread-2", rec.ThreadID)
+}
+
+func TestDeliverThreadModeSplitsLongMessage(t *testing.T) {
+	h, f := stubDiscord()
+	openMessages(t, h)
+	job := threadJob(jira.EventIssueCreated)
+	job.Message.Embeds[0].Description = strings.Repeat("word ", 2000)
+	require.NoError(t, h.deliver(job))
+	require.Len(t, f.posts, 2)
+	require.Equal(t, []string{"", "thread-1"}, f.threads)
+	require.Equal(t, "PRJ-1: Test", f.posts[0].ThreadName)
+	require.Equal(t, "PRJ-1: Test (2/2)", f.posts[1].Embeds[0].Title)
+}
+
+func TestDeliverThreadModeResumesSplitMessage(t *testing.T) {
+	h, f := stubDiscord()
+	openMessages(t, h)
+	job := threadJob(jira.EventIssueCreated)
+	job.ID = "0001"
+	job.Message.Embeds[0].Description = strings.Repeat("word ", 3000)
+	parts := len(discord.Split(job.Message))
+	require.Greater(t, parts, 2)
+
+	post := f.post
+	f.post = func(url, threadID string, msg discord.WebhookMessage) (*discord.Message, error) {
+		if len(f.posts) == 2 {
+			return nil, &discord.StatusError{StatusCode: 500, Body: "down"}
+		}
+		return post(url, threadID, msg)
+	}
+	require.Error(t, h.deliver(job))
+	require.Len(t, f.posts, 2)
+
+	// The retry continues in the same thread after the parts already sent.
+	f.post = post
+	require.NoError(t, h.deliver(job))
+	require.Len(t, f.posts, parts)
+	for i, msg := range f.posts[1:] {
+		require.Contains(t, msg.Embeds[0].Title, "("+strconv.Itoa(i+2)+"/")
+	}
+	require.False(t, h.Messages.Get(partsKey(job.ID), new(int)), "progress should be forgotten once delivered")
+}
+
+func TestDeliverPostModeResumesSplitMessage(t *testing.T) {
+	n := &fakeNotifier{}
+	h := newHandler(n)
+	openMessages(t, h)
+	var sent []string
+	fail := true
+	n.send = func(_ string, msg discord.WebhookMessage) error {
+		if fail && len(sent) == 1 {
+			fail = false
+			return errors.New("discord down")
+		}
+		sent = append(sent, msg.Embeds[0].Title)
+		return nil
+	}
+	job := queue.Job{
+		ID:          "0001",
+		Destination: routing.Destination{Name: "general"},
+		Message: discord.WebhookMessage{Embeds: []discord.Embed{{
+			Title:       "PRJ-1: Test",
+			Description: strings.Repeat("word ", 2000),
+		}}},
+	}
+	require.Error(t, h.deliver(job))
+	require.NoError(t, h.deliver(job))
+	require.Equal(t, []string{"PRJ-1: Test (1/2)", "PRJ-1: Test (2/2)"}, sent)
+}
+
+func TestThreadNameTruncated(t *testing.T) {
+	job := threadJob(jira.EventIssueCreated)
+	job.Summary = strings.Repeat("é", 200)
+	name := threadName(job)
+	require.Equal(t, maxThreadName, utf8.RuneCountInString(name))
+	require.True(t, strings.HasSuffix(name, "…"))
+}
+
+func TestDeliverUploadsAttachments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("data:" + r.URL.Path))
+	}))
+	defer srv.Close()
+	h, f := stubDiscord()
+	h.Attachments = jira.NewAttachmentClient(srv.URL, "bot@example.com", "token", 1<<20)
+
+	var sent discord.WebhookMessage
+	f.send = func(url string, msg discord.WebhookMessage) error {
+		sent = msg
+		return nil
+	}
+
+	job := queue.Job{
+		Destination: routing.Destination{Name: "general", URL: "https://discord.example.com/general"},
+		IssueKey:    "PRJ-1",
+		Message:     discord.WebhookMessage{Embeds: []discord.Embed{{Title: "PRJ-1: Test"}}},
+		Attachments: []jira.Attachment{
+			{Filename: "notes.txt", MimeType: "text/plain", Content: srv.URL + "/notes.txt"},
+			{Filename: "missing.pdf", Content: srv.URL + "/missing.pdf"},
+			{Filename: "my shot.png", MimeType: "image/png", Content: srv.URL + "/shot.png"},
+			{Filename: "my_shot.png", Content: srv.URL + "/shot2.png"},
+		},
+	}
+	require.NoError(t, h.deliver(job))
+	require.Len(t, sent.Files, 3)
+	require.Equal(t, "notes.txt", sent.Files[0].Name)
+	require.Equal(t, "my_shot.png", sent.Files[1].Name)
+	require.Equal(t, "data:/shot.png", string(sent.Files[1].Data))
+	require.Equal(t, "my_shot-2.png", sent.Files[2].Name)
+	require.Equal(t, "attachment://my_shot.png", sent.Embeds[0].Image.URL)
+	require.Nil(t, job.Message.Embeds[0].Image, "the queued message must not change")
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"jira-discord-webhook/internal/discord"
+)
+
+// BuildInfo identifies the running build.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Discord deliveries make the service unready only after
+// discordFailureThreshold consecutive failures, and only while the latest
+// is more recent than discordFailureWindow. A single failure is retried by
+// the queue, and an instance taken out of rotation receives no new events
+// that could clear the check.
+const (
+	discordFailureThreshold = 3
+	discordFailureWindow    = 5 * time.Minute
+)
+
+// deliveryResult is the outcome of the most recent Discord delivery.
+type deliveryResult struct {
+	At          time.Time
+	Destination string
+	// Cause describes the failure without the error text, which can
+	// include the webhook URL and its token.
+	Cause string
+	// Failures counts the consecutive failed deliveries.
+	Failures int
+}
+
+func (h *WebhookHandler) recordDelivery(destination string, err error) {
+	for {
+		prev := h.lastDelivery.Load()
+		r := &deliveryResult{At: time.Now().UTC(), Destination: destination}
+		if err != nil {
+			r.Cause = deliveryCause(err)
+			r.Failures = 1
+			if prev != nil {
+				r.Failures += prev.Failures
+			}
+		}
+		if h.lastDelivery.CompareAndSwap(prev, r) {
+			return
+		}
+	}
+}
+
+// deliveryCause summarises a delivery error for the unauthenticated
+// readiness endpoint.
+func deliveryCause(err error) string {
+	var se *discord.StatusError
+	switch {
+	case errors.As(err, &se):
+		return fmt.Sprintf("Discord returned status %d", se.StatusCode)
+	case errors.Is(err, discord.ErrRateLimited):
+		return "rate limited by Discord"
+	case errors.Is(err, discord.ErrNoWebhookURL):
+		return "no webhook URL configured"
+	case errors.Is(err, context.Canceled):
+		return "aborted"
+	default:
+		return "network error"
+	}
+}
+
+// RegisterHealth adds the liveness, readiness and version endpoints to r.
+func (h *WebhookHandler) RegisterHealth(r fiber.Router) {
+	r.Get("/healthz", Healthz)
+	r.Get("/readyz", h.Readyz)
+	r.Get("/version", h.Version)
+}
+
+// Healthz reports that the process is running and serving requests.
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// check is the result of one readiness check.
+type check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readyz reports whether the service can accept and deliver events: the
+// user mapping is loaded, the spool is writable, the queue has capacity
+// and Discord deliveries are not failing repeatedly. It responds with 503
+// when any check fails.
+func (h *WebhookHandler) Readyz(c *fiber.Ctx) error {
+	var checks []check
+	add := func(name, failure string) {
+		checks = append(checks, check{Name: name, OK: failure == "", Error: failure})
+	}
+
+	if provided(h.settings.Users) != nil {
+		add("config", "")
+	} else {
+		add("config", "user mapping not loaded")
+	}
+	if h.Queue != nil {
+		if err := h.Queue.Spool().CheckWritable(); err != nil {
+			add("spool", err.Error())
+		} else {
+			add("spool", "")
+		}
+		if h.Queue.Saturated() {
+			add("queue", "delivery queue is full")
+		} else {
+			add("queue", "")
+		}
+	}
+	last := h.lastDelivery.Load()
+	if last != nil && last.Failures >= discordFailureThreshold && time.Since(last.At) < discordFailureWindow {
+		add("discord", fmt.Sprintf("%d deliveries failed in a row, the last to %s: %s", last.Failures, last.Destination, last.Cause))
+	} else {
+		add("discord", "")
+	}
+
+	status, code := "ok", fiber.StatusOK
+	for _, ch := range checks {
+		if !ch.OK {
+			status, code = "unavailable", fiber.StatusServiceUnavailable
+		}
+	}
+	return c.Status(code).JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+// Version reports the build and the checksum of the loaded configuration.
+func (h *WebhookHandler) Version(c *fiber.Ctx) error {
+	v := struct {
+		BuildInfo
+		ConfigChecksum string `json:"configChecksum,omitempty"`
+	}{BuildInfo: h.settings.Build}
+	if h.settings.Configs != nil {
+		v.ConfigChecksum = h.settings.Configs.Checksum()
+	}
+	return c.JSON(v)
+}
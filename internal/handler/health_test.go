@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/reload"
+	"jira-discord-webhook/internal/utils"
+)
+
+func healthApp(h *WebhookHandler) *fiber.App {
+	app := fiber.New()
+	h.RegisterHealth(app)
+	return app
+}
+
+func getJSON(t *testing.T, app *fiber.App, path string) (int, map[string]any) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+	require.NoError(t, err)
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func TestHealthz(t *testing.T) {
+	code, body := getJSON(t, healthApp(newHandler(&fakeNotifier{})), "/healthz")
+	require.Equal(t, fiber.StatusOK, code)
+	require.Equal(t, "ok", body["status"])
+}
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+	var users atomic.Pointer[utils.UserMapping]
+	h := NewWebhookHandler(&fakeNotifier{}, nil, Settings{Users: users.Load})
+	app := healthApp(h)
+
+	code, _ := getJSON(t, app, "/readyz")
+	require.Equal(t, fiber.StatusServiceUnavailable, code, "not ready without a user mapping")
+
+	users.Store(&utils.UserMapping{})
+	code, body := getJSON(t, app, "/readyz")
+	require.Equal(t, fiber.StatusOK, code)
+	require.Equal(t, "ok", body["status"])
+
+	h.recordDelivery("general", &discord.StatusError{StatusCode: 500})
+	code, _ = getJSON(t, app, "/readyz")
+	require.Equal(t, fiber.StatusOK, code, "a single failed delivery is retried")
+	h.recordDelivery("general", nil)
+	code, _ = getJSON(t, app, "/readyz")
+	require.Equal(t, fiber.StatusOK, code)
+
+	spool, err := queue.OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	// Not started, so the single slot stays occupied.
+	h.Queue = queue.New(spool, h.Deliver, queue.Options{Size: 1})
+	require.NoError(t, h.Queue.Enqueue(queue.Job{IssueKey: "PRJ-1"}))
+	code, body = getJSON(t, app, "/readyz")
+	require.Equal(t, fiber.StatusServiceUnavailable, code, "not ready with a full queue")
+	require.Contains(t, body["checks"], map[string]any{"name": "queue", "ok": false, "error": "delivery queue is full"})
+}
+
+func TestReadyzDiscordFailures(t *testing.T) {
+	t.Parallel()
+	users := &utils.UserMapping{}
+	h := NewWebhookHandler(&fakeNotifier{}, nil, Settings{Users: func() *utils.UserMapping { return users }})
+	app := healthApp(h)
+
+	token := "SECRET-TOKEN"
+	err := &url.Error{Op: "Post", URL: "http://127.0.0.1:1/api/webhooks/123/" + token, Err: errors.New("connection refused")}
+	for i := 0; i < discordFailureThreshold; i++ {
+		h.recordDelivery("general", err)
+	}
+	resp, reqErr := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	require.NoError(t, reqErr)
+	require.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode, "not ready while deliveries keep failing")
+	b, _ := io.ReadAll(resp.Body)
+	require.NotContains(t, string(b), token)
+	require.NotContains(t, string(b), "/api/webhooks/")
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(b, &body))
+	require.Contains(t, body["checks"], map[string]any{"name": "discord", "ok": false, "error": "3 deliveries failed in a row, the last to general: network error"})
+
+	// Without further attempts the failures age out, so an instance taken
+	// out of rotation becomes ready again.
+	last := *h.lastDelivery.Load()
+	last.At = last.At.Add(-discordFailureWindow)
+	h.lastDelivery.Store(&last)
+	code, _ := getJSON(t, app, "/readyz")
+	require.Equal(t, fiber.StatusOK, code)
+}
+
+func TestDeliveryCause(t *testing.T) {
+	require.Equal(t, "Discord returned status 404", deliveryCause(fmt.Errorf("post: %w", &discord.StatusError{StatusCode: 404, Body: "Unknown Webhook"})))
+	require.Equal(t, "rate limited by Discord", deliveryCause(discord.ErrRateLimited))
+	require.Equal(t, "no webhook URL configured", deliveryCause(discord.ErrNoWebhookURL))
+	require.Equal(t, "network error", deliveryCause(&url.Error{Op: "Post", URL: "https://discord.com/api/webhooks/1/tok", Err: errors.New("timeout")}))
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "templates.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0o644))
+	configs := reload.New()
+	require.NoError(t, configs.Load("templates", path, func(string) error { return nil }))
+	app := healthApp(NewWebhookHandler(&fakeNotifier{}, nil, Settings{
+		Build:   BuildInfo{Version: "1.2.3", Commit: "abc123", BuildTime: "2025-06-23T08:00:00Z", GoVersion: "go1.24"},
+		Configs: configs,
+	}))
+
+	code, body := getJSON(t, app, "/version")
+	require.Equal(t, fiber.StatusOK, code)
+	require.Equal(t, "1.2.3", body["version"])
+	require.Equal(t, "abc123", body["commit"])
+	sum := body["configChecksum"].(string)
+	require.Len(t, sum, 64)
+
+	// The checksum follows the loaded content.
+	require.NoError(t, os.WriteFile(path, []byte("b"), 0o644))
+	require.Zero(t, configs.Reload())
+	_, body = getJSON(t, app, "/version")
+	require.NotEqual(t, sum, body["configChecksum"])
+}
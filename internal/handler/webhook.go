@@ -2,42 +2,283 @@ package handler
 
 import (
 	"encoding/json"
-	"os"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 
+	"jira-discord-webhook/internal/dedup"
 	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/filter"
 	"jira-discord-webhook/internal/jira"
+	"jira-discord-webhook/internal/metrics"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/reload"
+	"jira-discord-webhook/internal/routing"
+	"jira-discord-webhook/internal/store"
+	"jira-discord-webhook/internal/utils"
 )
 
-// WebhookHandler handles incoming Jira webhook requests and sends them to Discord.
-func WebhookHandler(c *fiber.Ctx) error {
+// WebhookIDHeader is set by Jira Cloud to the same value on every retry of
+// a delivery.
+const WebhookIDHeader = "X-Atlassian-Webhook-Identifier"
+
+// Settings configure a webhook handler.
+type Settings struct {
+	// BaseURL is the Jira browse URL issue links are built from, e.g.
+	// https://your-company.atlassian.net/browse. Empty omits the links.
+	BaseURL string
+	// Colors are the embed colors; the zero value selects jira.DefaultColors.
+	Colors jira.Colors
+
+	// The providers below return the configuration in effect. Handle calls
+	// each once per request, so a provider backed by an atomic pointer
+	// lets the configuration be reloaded while serving. A nil provider,
+	// or a nil result, means the configuration is not set.
+
+	// Routes resolve events to destinations. Without routes events go to
+	// the notifier's default webhook.
+	Routes func() *routing.Router
+	// Filters drop events before they are routed.
+	Filters func() *filter.Filter
+	// Templates render messages; without them the built-in layout is used.
+	Templates func() *jira.TemplateSet
+	// Users maps Jira users to the Discord users mentioned in their place.
+	// Readyz reports the service unready while it is not set.
+	Users func() *utils.UserMapping
+
+	// Build is reported by GET /version.
+	Build BuildInfo
+	// Configs, when set, provides the checksum of the loaded configuration
+	// reported by GET /version.
+	Configs *reload.Watcher
+}
+
+// provided returns the result of provider, or nil when there is none.
+func provided[T any](provider func() *T) *T {
+	if provider == nil {
+		return nil
+	}
+	return provider()
+}
+
+// Renderer converts a Jira webhook into the Discord message for a
+// destination. jira.RenderMessage is the default.
+type Renderer func(w jira.Webhook, baseURL string, opts jira.RenderOptions) discord.WebhookMessage
+
+// WebhookHandler receives Jira webhooks and delivers them to Discord. The
+// exported fields enable optional features; set them before serving
+// requests. Several handlers, each with its own notifier and state, can
+// be used in one process.
+type WebhookHandler struct {
+	// Queue, when set, makes Handle acknowledge events as soon as they are
+	// parsed and spooled; delivery to Discord then happens asynchronously
+	// through Deliver.
+	Queue *queue.Queue
+	// Dedup, when set, suppresses events already delivered to a
+	// destination within its window, whether Jira retried the request or
+	// fired several events for the same change.
+	Dedup *dedup.Cache
+	// Messages, when set, remembers the Discord message or thread of each
+	// issue so that destinations in edit mode update the message instead
+	// of posting a new one and destinations in thread mode post into the
+	// issue's thread.
+	Messages *store.Store
+	// Attachments, when set, downloads the Jira attachments referenced by
+	// a job so that they are uploaded with its message.
+	Attachments *jira.AttachmentClient
+	// DeadLetters stores notifications that could not be delivered. It is
+	// used by the admin endpoints and by Handle when no Queue is set.
+	DeadLetters *queue.DeadLetterStore
+
+	notifier discord.Notifier
+	render   Renderer
+	settings Settings
+
+	// issueLocks serialises deliveries for the same destination and issue
+	// so that concurrent workers do not both post a first message.
+	issueLocksMu sync.Mutex
+	issueLocks   map[string]*issueLock
+	lastDelivery atomic.Pointer[deliveryResult]
+}
+
+// NewWebhookHandler returns a handler that renders events with render, or
+// jira.RenderMessage when nil, and delivers them with notifier.
+func NewWebhookHandler(notifier discord.Notifier, render Renderer, s Settings) *WebhookHandler {
+	if render == nil {
+		render = jira.RenderMessage
+	}
+	return &WebhookHandler{notifier: notifier, render: render, settings: s}
+}
+
+// Handle handles an incoming Jira webhook request and sends the event to
+// Discord.
+func (h *WebhookHandler) Handle(c *fiber.Ctx) error {
+	s := h.settings
+	received := time.Now()
 	// Debug log: raw payload received from Jira
 	if ce := zap.L().Check(zap.DebugLevel, "JIRA payload"); ce != nil {
 		ce.Write(zap.ByteString("payload", c.Body()))
 	}
-
 	var payload jira.Webhook
 	if err := c.BodyParser(&payload); err != nil {
+		metrics.ParseFailures.Inc()
 		zap.L().Error("failed to decode JIRA payload", zap.Error(err))
 		return c.Status(fiber.StatusBadRequest).SendString("bad request")
 	}
+	metrics.EventsReceived.WithLabelValues(string(payload.Event()), payload.Issue.Fields.Project.Key).Inc()
+	if f := provided(s.Filters); f != nil {
+		if keep, reason := f.Apply(&payload); !keep {
+			metrics.EventsDropped.WithLabelValues("filtered").Inc()
+			zap.L().Info("filtered event",
+				zap.String("issue", payload.Issue.Key),
+				zap.String("event", string(payload.Event())),
+				zap.String("reason", reason))
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+	}
+	// Destinations may use different templates and table styles; render
+	// each combination once.
+	templates, users := provided(s.Templates), provided(s.Users)
+	messages := make(map[jira.RenderOptions]discord.WebhookMessage)
+	message := func(d routing.Destination) discord.WebhookMessage {
+		opts := jira.RenderOptions{
+			Template:  d.Template,
+			Tables:    d.TableStyle,
+			Colors:    s.Colors,
+			Templates: templates,
+			Users:     users,
+		}
+		msg, ok := messages[opts]
+		if !ok {
+			start := time.Now()
+			msg = h.render(payload, s.BaseURL, opts)
+			metrics.RenderDuration.Observe(time.Since(start).Seconds())
+			messages[opts] = msg
+			// Debug log: payload sent to Discord
+			if ce := zap.L().Check(zap.DebugLevel, "Discord payload"); ce != nil {
+				if b, err := json.Marshal(msg); err == nil {
+					ce.Write(zap.String("template", d.Template), zap.ByteString("payload", b))
+				}
+			}
+		}
+		return msg
+	}
 
-	baseURL := os.Getenv("JIRA_BASE_URL")
-	msg := jira.ToDiscordMessage(payload, baseURL)
+	// Without routes events go to the notifier's default webhook.
+	dests := []routing.Destination{{Name: "default"}}
+	if router := provided(s.Routes); router != nil {
+		dests = router.Destinations(payload)
+	}
+	if len(dests) == 0 {
+		metrics.EventsDropped.WithLabelValues("unrouted").Inc()
+		zap.L().Info("no Discord destination for event", zap.String("issue", payload.Issue.Key))
+		return c.SendStatus(fiber.StatusOK)
+	}
+	webhookID := c.Get(WebhookIDHeader)
+	fingerprint := payload.Fingerprint()
+	if h.Dedup != nil {
+		fresh := dests[:0:0]
+		for _, d := range dests {
+			if h.Dedup.Check(dedupKeys(d, webhookID, fingerprint)...) {
+				zap.L().Info("suppressed duplicate event",
+					zap.String("issue", payload.Issue.Key),
+					zap.String("destination", d.Name),
+					zap.String("webhookId", webhookID))
+				continue
+			}
+			fresh = append(fresh, d)
+		}
+		if len(fresh) == 0 {
+			metrics.EventsDropped.WithLabelValues("duplicate").Inc()
+			return c.Status(fiber.StatusOK).SendString("duplicate")
+		}
+		dests = fresh
+	}
 
-	// Debug log: payload sent to Discord
-	if ce := zap.L().Check(zap.DebugLevel, "Discord payload"); ce != nil {
-		if b, err := json.Marshal(msg); err == nil {
-			ce.Write(zap.ByteString("payload", b))
+	body := json.RawMessage(append([]byte(nil), c.Body()...))
+	var attachments []jira.Attachment
+	if h.Attachments != nil {
+		attachments = payload.ReferencedAttachments()
+	}
+	newJob := func(d routing.Destination) queue.Job {
+		return queue.Job{
+			Destination: d,
+			IssueKey:    payload.Issue.Key,
+			Summary:     payload.Issue.Fields.Summary,
+			Event:       string(payload.Event()),
+			Message:     message(d),
+			Attachments: attachments,
+			Payload:     body,
 		}
 	}
 
-	if err := discord.SendFunc(msg); err != nil {
-		zap.L().Error("failed to send to Discord", zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).SendString("failed to send to Discord")
+	if h.Queue != nil {
+		for i, d := range dests {
+			err := h.Queue.Enqueue(newJob(d))
+			if err != nil {
+				// Jira retries rejected requests; let the retry reach the
+				// destinations that were not enqueued.
+				h.forget(dests[i:], webhookID, fingerprint)
+			}
+			if errors.Is(err, queue.ErrFull) {
+				zap.L().Warn("delivery queue full, rejecting event", zap.String("issue", payload.Issue.Key))
+				return c.Status(fiber.StatusServiceUnavailable).SendString("delivery queue full")
+			}
+			if err != nil {
+				zap.L().Error("failed to enqueue Discord delivery", zap.String("destination", d.Name), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).SendString("failed to enqueue")
+			}
+		}
+		return c.SendStatus(fiber.StatusAccepted)
 	}
 
+	var failed []string
+	for _, d := range dests {
+		job := newJob(d)
+		if err := h.deliver(job); err != nil {
+			metrics.Deliveries.WithLabelValues(d.Name, "failed").Inc()
+			zap.L().Error("failed to send to Discord",
+				zap.String("destination", d.Name), zap.Error(err))
+			failed = append(failed, d.Name)
+			h.forget([]routing.Destination{d}, webhookID, fingerprint)
+			if h.DeadLetters != nil {
+				job.Attempts = 1
+				job.CreatedAt = time.Now().UTC()
+				if dlErr := h.DeadLetters.Add(job, err); dlErr != nil {
+					zap.L().Error("failed to store dead letter", zap.Error(dlErr))
+				}
+			}
+			continue
+		}
+		metrics.Delivered(d.Name, received)
+	}
+	if len(failed) > 0 {
+		return c.Status(fiber.StatusInternalServerError).
+			SendString("failed to send to Discord: " + strings.Join(failed, ", "))
+	}
 	return c.SendStatus(fiber.StatusOK)
 }
+
+// dedupKeys returns the keys identifying an event for destination d.
+func dedupKeys(d routing.Destination, webhookID, fingerprint string) []string {
+	keys := []string{d.Name + "|fp:" + fingerprint}
+	if webhookID != "" {
+		keys = append(keys, d.Name+"|id:"+webhookID)
+	}
+	return keys
+}
+
+// forget drops the dedup keys of an event that was not delivered.
+func (h *WebhookHandler) forget(dests []routing.Destination, webhookID, fingerprint string) {
+	if h.Dedup == nil {
+		return
+	}
+	for _, d := range dests {
+		h.Dedup.Forget(dedupKeys(d, webhookID, fingerprint)...)
+	}
+}
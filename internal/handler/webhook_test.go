@@ -2,35 +2,79 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 
+	"jira-discord-webhook/internal/dedup"
 	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/filter"
 	"jira-discord-webhook/internal/jira"
+	"jira-discord-webhook/internal/metrics"
+	"jira-discord-webhook/internal/queue"
+	"jira-discord-webhook/internal/routing"
+	"jira-discord-webhook/internal/utils"
 )
 
-func setupApp() *fiber.App {
+// fakeNotifier is a discord.Notifier whose methods tests replace. Calls
+// without a replacement succeed.
+type fakeNotifier struct {
+	send func(url string, msg discord.WebhookMessage) error
+	post func(url, threadID string, msg discord.WebhookMessage) (*discord.Message, error)
+	edit func(url, messageID string, msg discord.WebhookMessage) error
+}
+
+func (n *fakeNotifier) Send(_ context.Context, url string, msg discord.WebhookMessage) error {
+	if n.send == nil {
+		return nil
+	}
+	return n.send(url, msg)
+}
+
+func (n *fakeNotifier) Post(_ context.Context, url, threadID string, msg discord.WebhookMessage) (*discord.Message, error) {
+	if n.post == nil {
+		return &discord.Message{}, nil
+	}
+	return n.post(url, threadID, msg)
+}
+
+func (n *fakeNotifier) Edit(_ context.Context, url, messageID string, msg discord.WebhookMessage) error {
+	if n.edit == nil {
+		return nil
+	}
+	return n.edit(url, messageID, msg)
+}
+
+func (n *fakeNotifier) Delete(context.Context, string, string) error {
+	return nil
+}
+
+func newHandler(n discord.Notifier) *WebhookHandler {
+	return NewWebhookHandler(n, nil, Settings{})
+}
+
+func setupApp(h *WebhookHandler) *fiber.App {
 	app := fiber.New()
-	app.Post("/webhook", WebhookHandler)
+	app.Post("/webhook", h.Handle)
 	return app
 }
 
 func TestWebhookHandlerSuccess(t *testing.T) {
-	app := setupApp()
-	os.Setenv("JIRA_BASE_URL", "https://jira.example.com/browse")
-	defer os.Unsetenv("JIRA_BASE_URL")
-
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(NewWebhookHandler(n, nil, Settings{BaseURL: "https://jira.example.com/browse"}))
 
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
+		require.Equal(t, "https://jira.example.com/browse/PRJ-1", msg.Embeds[0].URL)
 		return nil
 	}
 
@@ -52,16 +96,14 @@ func TestWebhookHandlerSuccess(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerMissingBaseURL(t *testing.T) {
-	app := setupApp()
-	os.Unsetenv("JIRA_BASE_URL")
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -80,15 +122,61 @@ func TestWebhookHandlerMissingBaseURL(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
+}
+
+func TestWebhookHandlersCoexist(t *testing.T) {
+	t.Parallel()
+	colors := jira.DefaultColors
+	colors.Issue = 0x123456
+	templates, err := jira.ParseTemplates([]byte("templates:\n  short:\n    title: \"{{ .Issue.Key }} for {{ mention .Issue.Fields.Assignee.DisplayName }}\"\ndefault: short\n"))
+	require.NoError(t, err)
+	users, err := utils.ParseUserMapping([]byte("jira_to_discord:\n  - displayName: Bob\n    discordId: \"42\"\n"))
+	require.NoError(t, err)
+	var sentA, sentB []discord.WebhookMessage
+	var urlA string
+	a := NewWebhookHandler(&fakeNotifier{send: func(url string, msg discord.WebhookMessage) error {
+		urlA = url
+		sentA = append(sentA, msg)
+		return nil
+	}}, nil, Settings{
+		Colors:    colors,
+		Templates: func() *jira.TemplateSet { return templates },
+		Users:     func() *utils.UserMapping { return users },
+	})
+	b := NewWebhookHandler(&fakeNotifier{send: func(url string, msg discord.WebhookMessage) error {
+		sentB = append(sentB, msg)
+		return nil
+	}}, func(w jira.Webhook, baseURL string, opts jira.RenderOptions) discord.WebhookMessage {
+		return discord.WebhookMessage{Username: "custom " + w.Issue.Key}
+	}, Settings{})
+	app := fiber.New()
+	app.Post("/a", a.Handle)
+	app.Post("/b", b.Handle)
+
+	for _, path := range []string{"/a", "/b"} {
+		w := jira.Webhook{Issue: jira.Issue{Key: "PRJ-1"}}
+		w.Issue.Fields.Assignee.DisplayName = "Bob"
+		body, _ := json.Marshal(w)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+	require.Len(t, sentA, 1)
+	require.Empty(t, urlA, "without routes the notifier's default webhook is used")
+	require.Equal(t, 0x123456, sentA[0].Embeds[0].Color)
+	require.Equal(t, "PRJ-1 for <@42>", sentA[0].Embeds[0].Title, "templates and user mapping come from the settings")
+	require.Len(t, sentB, 1)
+	require.Equal(t, "custom PRJ-1", sentB[0].Username)
 }
 
 func TestWebhookHandlerCommentAndChangelog(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var gotMsg discord.WebhookMessage
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		gotMsg = msg
 		return nil
 	}
@@ -125,11 +213,10 @@ func TestWebhookHandlerCommentAndChangelog(t *testing.T) {
 }
 
 func TestWebhookHandlerMinimalPayload(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -140,15 +227,14 @@ func TestWebhookHandlerMinimalPayload(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerExtraFields(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -162,15 +248,14 @@ func TestWebhookHandlerExtraFields(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerNilCommentChangelog(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -185,14 +270,13 @@ func TestWebhookHandlerNilCommentChangelog(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerDiscordCustomError(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		return fiber.ErrBadGateway
 	}
 	payload := jira.Webhook{Issue: jira.Issue{Key: "PRJ-6"}}
@@ -205,11 +289,10 @@ func TestWebhookHandlerDiscordCustomError(t *testing.T) {
 }
 
 func TestWebhookHandlerLargeValidPayload(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -221,15 +304,14 @@ func TestWebhookHandlerLargeValidPayload(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerEmptyIssueKey(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -240,15 +322,14 @@ func TestWebhookHandlerEmptyIssueKey(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerEmptyFields(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -259,15 +340,14 @@ func TestWebhookHandlerEmptyFields(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerEmptyCommentBody(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -281,15 +361,14 @@ func TestWebhookHandlerEmptyCommentBody(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerEmptyChangelogItems(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -303,15 +382,14 @@ func TestWebhookHandlerEmptyChangelogItems(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerCommentNoAuthor(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
 	var called bool
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		called = true
 		return nil
 	}
@@ -325,24 +403,25 @@ func TestWebhookHandlerCommentNoAuthor(t *testing.T) {
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusOK, resp.StatusCode)
-	require.True(t, called, "SendFunc should be called")
+	require.True(t, called, "notifier should be called")
 }
 
 func TestWebhookHandlerBadRequestPayload(t *testing.T) {
-	app := setupApp()
+	app := setupApp(newHandler(&fakeNotifier{}))
+	before := testutil.ToFloat64(metrics.ParseFailures)
 	// Invalid JSON
 	req := httptest.NewRequest("POST", "/webhook", bytes.NewBufferString("{"))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := app.Test(req)
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, before+1, testutil.ToFloat64(metrics.ParseFailures))
 }
 
 func TestWebhookHandlerDiscordSendError(t *testing.T) {
-	app := setupApp()
-	original := discord.SendFunc
-	defer func() { discord.SendFunc = original }()
-	discord.SendFunc = func(msg discord.WebhookMessage) error {
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
+	n.send = func(_ string, msg discord.WebhookMessage) error {
 		return fiber.ErrInternalServerError
 	}
 	payload := jira.Webhook{Issue: jira.Issue{Key: "PRJ-ERR"}}
@@ -355,7 +434,7 @@ func TestWebhookHandlerDiscordSendError(t *testing.T) {
 }
 
 func TestWebhookHandlerEmptyBody(t *testing.T) {
-	app := setupApp()
+	app := setupApp(newHandler(&fakeNotifier{}))
 	req := httptest.NewRequest("POST", "/webhook", nil)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := app.Test(req)
@@ -364,7 +443,7 @@ func TestWebhookHandlerEmptyBody(t *testing.T) {
 }
 
 func TestWebhookHandlerUnsupportedMethod(t *testing.T) {
-	app := setupApp()
+	app := setupApp(newHandler(&fakeNotifier{}))
 	// Fiber returns 405 Method Not Allowed for unsupported methods on a registered route
 	resp, err := app.Test(httptest.NewRequest("GET", "/webhook", nil))
 	require.NoError(t, err)
@@ -372,8 +451,230 @@ func TestWebhookHandlerUnsupportedMethod(t *testing.T) {
 }
 
 func TestWebhookHandlerUnregisteredRoute(t *testing.T) {
-	app := setupApp()
+	app := setupApp(newHandler(&fakeNotifier{}))
 	resp, err := app.Test(httptest.NewRequest("POST", "/notfound", nil))
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
 }
+
+func TestWebhookHandlerRoutesFanOut(t *testing.T) {
+	t.Parallel()
+	n := &fakeNotifier{}
+	r, err := routing.New(routing.Config{
+		Destinations: []routing.Destination{
+			{Name: "general", URL: "https://discord.example.com/general"},
+			{Name: "backend", URL: "https://discord.example.com/backend"},
+		},
+		Routes: []routing.Route{
+			{Name: "be", Match: routing.Match{Projects: []string{"BE"}}, Destinations: []string{"backend", "general"}},
+		},
+		Default: []string{"general"},
+	})
+	require.NoError(t, err)
+	app := setupApp(NewWebhookHandler(n, nil, Settings{Routes: func() *routing.Router { return r }}))
+
+	var urls []string
+	n.send = func(url string, msg discord.WebhookMessage) error {
+		urls = append(urls, url)
+		return nil
+	}
+
+	payload := jira.Webhook{Issue: jira.Issue{Key: "BE-1"}}
+	payload.Issue.Fields.Project.Key = "BE"
+	b, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"https://discord.example.com/backend", "https://discord.example.com/general"}, urls)
+}
+
+func TestWebhookHandlerRoutesPartialFailure(t *testing.T) {
+	t.Parallel()
+	n := &fakeNotifier{}
+	r, err := routing.New(routing.Config{
+		Destinations: []routing.Destination{
+			{Name: "general", URL: "https://discord.example.com/general"},
+			{Name: "backend", URL: "https://discord.example.com/backend"},
+		},
+		Default: []string{"general", "backend"},
+	})
+	require.NoError(t, err)
+	app := setupApp(NewWebhookHandler(n, nil, Settings{Routes: func() *routing.Router { return r }}))
+
+	var calls int
+	n.send = func(url string, msg discord.WebhookMessage) error {
+		calls++
+		if url == "https://discord.example.com/backend" {
+			return fiber.ErrBadGateway
+		}
+		return nil
+	}
+
+	payload := jira.Webhook{Issue: jira.Issue{Key: "PRJ-1"}}
+	b, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, 2, calls, "every destination should be attempted")
+	body, _ := io.ReadAll(resp.Body)
+	require.Contains(t, string(body), "backend")
+	require.NotContains(t, string(body), "general")
+}
+
+func TestWebhookHandlerQueued(t *testing.T) {
+	n := &fakeNotifier{}
+	h := newHandler(n)
+	app := setupApp(h)
+	delivered := make(chan discord.WebhookMessage, 1)
+	n.send = func(_ string, msg discord.WebhookMessage) error {
+		delivered <- msg
+		return nil
+	}
+
+	spool, err := queue.OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	h.Queue = queue.New(spool, h.Deliver, queue.Options{Size: 10, Workers: 1, MaxAttempts: 1})
+	require.NoError(t, h.Queue.Start())
+	defer h.Queue.Stop()
+
+	payload := jira.Webhook{Issue: jira.Issue{Key: "PRJ-Q"}}
+	payload.Issue.Fields.Summary = "Queued"
+	b, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusAccepted, resp.StatusCode)
+
+	select {
+	case msg := <-delivered:
+		require.Equal(t, "PRJ-Q: Queued", msg.Embeds[0].Title)
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued message was not delivered")
+	}
+}
+
+func TestWebhookHandlerQueueFull(t *testing.T) {
+	n := &fakeNotifier{}
+	h := newHandler(n)
+	app := setupApp(h)
+	spool, err := queue.OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	// Not started, so the single slot stays occupied.
+	h.Queue = queue.New(spool, h.Deliver, queue.Options{Size: 1})
+
+	send := func() int {
+		b, _ := json.Marshal(jira.Webhook{Issue: jira.Issue{Key: "PRJ-FULL"}})
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	require.Equal(t, fiber.StatusAccepted, send())
+	require.Equal(t, fiber.StatusServiceUnavailable, send())
+}
+
+func TestWebhookHandlerDedup(t *testing.T) {
+	n := &fakeNotifier{}
+	h := newHandler(n)
+	app := setupApp(h)
+	h.Dedup = dedup.New(time.Minute)
+	calls := 0
+	fail := false
+	n.send = func(_ string, msg discord.WebhookMessage) error {
+		calls++
+		if fail {
+			return fiber.ErrBadGateway
+		}
+		return nil
+	}
+	post := func(payload jira.Webhook, webhookID string) int {
+		b, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		if webhookID != "" {
+			req.Header.Set(WebhookIDHeader, webhookID)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	comment := &jira.Comment{ID: "100", Body: "looks good"}
+	updated := jira.Webhook{WebhookEvent: "jira:issue_updated", IssueEventTypeName: "issue_commented", Issue: jira.Issue{Key: "PRJ-D"}, Comment: comment}
+	created := jira.Webhook{WebhookEvent: "comment_created", Issue: jira.Issue{Key: "PRJ-D"}, Comment: comment}
+
+	require.Equal(t, fiber.StatusOK, post(updated, "hook-1"))
+	require.Equal(t, fiber.StatusOK, post(updated, "hook-1"), "retry")
+	require.Equal(t, fiber.StatusOK, post(created, "hook-2"), "same comment, different event")
+	require.Equal(t, 1, calls)
+
+	other := jira.Webhook{WebhookEvent: "comment_created", Issue: jira.Issue{Key: "PRJ-D"}, Comment: &jira.Comment{ID: "101", Body: "another"}}
+	fail = true
+	require.Equal(t, fiber.StatusInternalServerError, post(other, "hook-3"))
+	fail = false
+	require.Equal(t, fiber.StatusOK, post(other, "hook-3"), "retry after failure must be delivered")
+	require.Equal(t, 3, calls)
+}
+
+func TestWebhookHandlerFiltered(t *testing.T) {
+	t.Parallel()
+	n := &fakeNotifier{}
+	f, err := filter.Parse([]byte("ignore_fields: [Rank]\nexclude:\n  - projects: [NOISE]\n"))
+	require.NoError(t, err)
+	app := setupApp(NewWebhookHandler(n, nil, Settings{Filters: func() *filter.Filter { return f }}))
+	var sent []discord.WebhookMessage
+	n.send = func(_ string, msg discord.WebhookMessage) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	post := func(payload jira.Webhook) int {
+		b, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	rank := jira.Webhook{WebhookEvent: "jira:issue_updated", Issue: jira.Issue{Key: "PRJ-F"},
+		Changelog: &jira.Changelog{Items: []jira.ChangelogItem{{Field: "Rank", ToString: "Ranked higher"}}}}
+	require.Equal(t, fiber.StatusNoContent, post(rank))
+
+	noise := jira.Webhook{WebhookEvent: "jira:issue_created", Issue: jira.Issue{Key: "NOISE-1"}}
+	noise.Issue.Fields.Project.Key = "NOISE"
+	require.Equal(t, fiber.StatusNoContent, post(noise))
+	require.Empty(t, sent)
+
+	rank.Changelog.Items = append(rank.Changelog.Items, jira.ChangelogItem{Field: "status", FromString: "Open", ToString: "Done"})
+	require.Equal(t, fiber.StatusOK, post(rank))
+	require.Len(t, sent, 1)
+	for _, field := range sent[0].Embeds[0].Fields {
+		require.NotContains(t, field.Value, "Ranked higher")
+	}
+}
+
+func TestWebhookHandlerADFComment(t *testing.T) {
+	n := &fakeNotifier{}
+	app := setupApp(newHandler(n))
+	var got discord.WebhookMessage
+	n.send = func(_ string, msg discord.WebhookMessage) error {
+		got = msg
+		return nil
+	}
+	body := `{"webhookEvent":"comment_created","issue":{"key":"PRJ-A","fields":{"summary":"ADF","description":null}},
+		"comment":{"id":"1","author":{"displayName":"Alice"},"body":{"type":"doc","version":1,"content":[
+		{"type":"paragraph","content":[{"type":"text","text":"ship it","marks":[{"type":"strong"}]}]}]}}}`
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, "Comment", got.Embeds[0].Fields[0].Name)
+	require.Equal(t, "**ship it**", got.Embeds[0].Fields[0].Value)
+}
@@ -0,0 +1,369 @@
+package jira
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"jira-discord-webhook/internal/utils"
+)
+
+// ADFNode is a node of an Atlassian Document Format document, the rich
+// text format Jira Cloud uses for descriptions and comments in REST v3.
+type ADFNode struct {
+	Type    string         `json:"type"`
+	Text    string         `json:"text,omitempty"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+	Marks   []ADFMark      `json:"marks,omitempty"`
+	Content []ADFNode      `json:"content,omitempty"`
+}
+
+// ADFMark formats an ADF text node, e.g. strong or link.
+type ADFMark struct {
+	Type  string         `json:"type"`
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+// ParseADF decodes an ADF document.
+func ParseADF(b []byte) (*ADFNode, error) {
+	var doc ADFNode
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Type != "doc" {
+		return nil, errors.New("adf: root node is not a doc")
+	}
+	return &doc, nil
+}
+
+// panelEmoji prefixes panels by their panelType.
+var panelEmoji = map[string]string{
+	"info":    "ℹ️",
+	"note":    "📝",
+	"warning": "⚠️",
+	"success": "✅",
+	"error":   "❌",
+}
+
+// ADFToMarkdown renders an ADF document as Discord markdown. Mentions use
+// the Discord user users maps the Jira account ID to when there is one.
+func ADFToMarkdown(doc *ADFNode, users *utils.UserMapping) string {
+	return ADFToMarkdownStyle(doc, TableMarkdown, users)
+}
+
+// ADFToMarkdownStyle is ADFToMarkdown with tables rendered in the given
+// style.
+func ADFToMarkdownStyle(doc *ADFNode, tables TableStyle, users *utils.UserMapping) string {
+	return strings.TrimSpace(adfBlocks(doc.Content, markdownStyle{tables: tables, users: users}))
+}
+
+// markdownStyle holds the settings ADF block nodes are rendered with.
+type markdownStyle struct {
+	tables TableStyle
+	users  *utils.UserMapping
+}
+
+// adfBlocks renders block nodes on consecutive lines.
+func adfBlocks(nodes []ADFNode, st markdownStyle) string {
+	var parts []string
+	for _, n := range nodes {
+		if s := adfBlock(n, st); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func adfBlock(n ADFNode, st markdownStyle) string {
+	switch n.Type {
+	case "paragraph":
+		return adfInline(n.Content, st.users)
+	case "heading":
+		level := attrInt(n.Attrs, "level", 1)
+		if level < 1 || level > 6 {
+			level = 1
+		}
+		return strings.Repeat("#", level) + " " + adfInline(n.Content, st.users)
+	case "bulletList":
+		return adfList(n.Content, st, func(int) string { return "- " })
+	case "orderedList":
+		start := attrInt(n.Attrs, "order", 1)
+		return adfList(n.Content, st, func(i int) string { return strconv.Itoa(start+i) + ". " })
+	case "taskList", "decisionList":
+		return adfList(n.Content, st, func(int) string { return "" })
+	case "taskItem":
+		box := "☐ "
+		if attrString(n.Attrs, "state") == "DONE" {
+			box = "☑ "
+		}
+		return box + adfInline(n.Content, st.users)
+	case "decisionItem":
+		return "✅ " + adfInline(n.Content, st.users)
+	case "codeBlock":
+		var b strings.Builder
+		for _, c := range n.Content {
+			b.WriteString(c.Text)
+		}
+		return "```" + attrString(n.Attrs, "language") + "\n" + b.String() + "\n```"
+	case "blockquote":
+		return prefixLines(adfBlocks(n.Content, st), "> ")
+	case "panel":
+		body := adfBlocks(n.Content, st)
+		if emoji := panelEmoji[attrString(n.Attrs, "panelType")]; emoji != "" {
+			body = emoji + " " + body
+		}
+		return prefixLines(body, "> ")
+	case "expand", "nestedExpand":
+		body := adfBlocks(n.Content, st)
+		if title := attrString(n.Attrs, "title"); title != "" {
+			body = "**" + escapeMarkdown(title) + "**\n" + body
+		}
+		return body
+	case "rule":
+		return "---"
+	case "table":
+		return adfTable(n, st)
+	case "mediaSingle", "mediaGroup":
+		var parts []string
+		for _, c := range n.Content {
+			if s := adfMedia(c); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, "\n")
+	case "media":
+		return adfMedia(n)
+	case "blockCard", "embedCard":
+		if url := attrString(n.Attrs, "url"); url != "" {
+			return "<" + url + ">"
+		}
+		return ""
+	case "extension":
+		return ""
+	}
+	if len(n.Content) > 0 && isInlineNode(n.Content[0]) {
+		return adfInline(n.Content, st.users)
+	}
+	if n.Text != "" {
+		return adfInline([]ADFNode{n}, st.users)
+	}
+	return adfBlocks(n.Content, st)
+}
+
+// adfList renders list items, indenting nested content under the marker.
+func adfList(items []ADFNode, st markdownStyle, marker func(i int) string) string {
+	var lines []string
+	for i, item := range items {
+		m := marker(i)
+		var body string
+		if item.Type == "listItem" {
+			body = adfBlocks(item.Content, st)
+		} else {
+			body = adfBlock(item, st)
+		}
+		indent := strings.Repeat(" ", len([]rune(m)))
+		for j, line := range strings.Split(body, "\n") {
+			if j == 0 {
+				lines = append(lines, m+line)
+			} else if line != "" {
+				lines = append(lines, indent+line)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// adfTable renders a table in the given style. The first row holds
+// headers when all its cells are tableHeader nodes.
+func adfTable(n ADFNode, st markdownStyle) string {
+	var rows [][]tableCell
+	header := len(n.Content) > 0
+	for i, row := range n.Content {
+		var cells []tableCell
+		for _, cell := range row.Content {
+			text := strings.ReplaceAll(adfBlocks(cell.Content, st), "\n", " ")
+			cells = append(cells, tableCell{text: strings.TrimSpace(text), plain: strings.TrimSpace(adfPlain(cell.Content))})
+			if i == 0 && cell.Type != "tableHeader" {
+				header = false
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return renderTable(rows, header, st.tables)
+}
+
+// adfPlain returns the text of nodes without markup, for table cells shown
+// in a code block.
+func adfPlain(nodes []ADFNode) string {
+	var parts []string
+	for _, n := range nodes {
+		var s string
+		switch n.Type {
+		case "text":
+			s = n.Text
+		case "hardBreak":
+			s = " "
+		case "mention":
+			if s = attrString(n.Attrs, "text"); s == "" {
+				s = "@" + attrString(n.Attrs, "id")
+			}
+		case "emoji", "status":
+			s = attrString(n.Attrs, "text")
+		case "inlineCard":
+			s = attrString(n.Attrs, "url")
+		default:
+			s = adfPlain(n.Content)
+			if !isInlineNode(n) && s != "" {
+				s += " "
+			}
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "")
+}
+
+func adfMedia(n ADFNode) string {
+	alt := attrString(n.Attrs, "alt")
+	if url := attrString(n.Attrs, "url"); url != "" {
+		return "![" + escapeMarkdown(alt) + "](" + url + ")"
+	}
+	if alt == "" {
+		alt = "attachment"
+	}
+	return "📎 " + escapeMarkdown(alt)
+}
+
+func isInlineNode(n ADFNode) bool {
+	switch n.Type {
+	case "text", "hardBreak", "mention", "emoji", "inlineCard", "status", "date", "placeholder", "mediaInline":
+		return true
+	}
+	return false
+}
+
+// adfInline renders inline nodes such as text, mentions and emoji.
+func adfInline(nodes []ADFNode, users *utils.UserMapping) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Type {
+		case "text":
+			b.WriteString(adfText(n))
+		case "hardBreak":
+			b.WriteString("\n")
+		case "mention":
+			id := attrString(n.Attrs, "id")
+			if m := users.Mention(id); id != "" && m != id {
+				b.WriteString(m)
+			} else if text := attrString(n.Attrs, "text"); text != "" {
+				b.WriteString(escapeMarkdown(text))
+			} else {
+				b.WriteString("@" + id)
+			}
+		case "emoji":
+			if text := attrString(n.Attrs, "text"); text != "" {
+				b.WriteString(text)
+			} else {
+				b.WriteString(attrString(n.Attrs, "shortName"))
+			}
+		case "inlineCard":
+			if url := attrString(n.Attrs, "url"); url != "" {
+				b.WriteString("<" + url + ">")
+			}
+		case "status":
+			b.WriteString("`" + strings.ToUpper(attrString(n.Attrs, "text")) + "`")
+		case "date":
+			if ms, err := strconv.ParseInt(attrString(n.Attrs, "timestamp"), 10, 64); err == nil {
+				fmt.Fprintf(&b, "<t:%d:D>", ms/1000)
+			}
+		case "mediaInline":
+			b.WriteString(adfMedia(n))
+		case "placeholder":
+		default:
+			if n.Text != "" {
+				b.WriteString(escapeMarkdown(n.Text))
+			}
+			b.WriteString(adfInline(n.Content, users))
+		}
+	}
+	return b.String()
+}
+
+// adfText applies a text node's marks. Markers go around the trimmed text
+// because Discord ignores "** bold**".
+func adfText(n ADFNode) string {
+	text := n.Text
+	core := strings.TrimSpace(text)
+	if core == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, core)]
+	trail := text[len(lead)+len(core):]
+
+	var code bool
+	var href string
+	for _, m := range n.Marks {
+		switch m.Type {
+		case "code":
+			code = true
+		case "link":
+			href = attrString(m.Attrs, "href")
+		}
+	}
+	if code {
+		core = "`" + strings.ReplaceAll(core, "`", "'") + "`"
+	} else {
+		core = escapeMarkdown(core)
+		for _, m := range n.Marks {
+			switch m.Type {
+			case "strong":
+				core = "**" + core + "**"
+			case "em":
+				core = "_" + core + "_"
+			case "underline":
+				core = "__" + core + "__"
+			case "strike":
+				core = "~~" + core + "~~"
+			}
+		}
+	}
+	if href != "" {
+		core = "[" + core + "](" + href + ")"
+	}
+	return lead + core + trail
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`,
+)
+
+// escapeMarkdown escapes characters Discord would treat as formatting.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func prefixLines(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+func attrString(attrs map[string]any, key string) string {
+	switch v := attrs[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func attrInt(attrs map[string]any, key string, def int) int {
+	if v, ok := attrs[key].(float64); ok {
+		return int(v)
+	}
+	return def
+}
@@ -0,0 +1,94 @@
+package jira
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"jira-discord-webhook/internal/utils"
+)
+
+func TestADFToMarkdown(t *testing.T) {
+	w := loadWebhook(t, "adf_issue.json")
+	doc, ok := w.Issue.Fields.Description.ADF()
+	if !ok {
+		t.Fatal("expected an ADF description")
+	}
+	want := "## Steps\n" +
+		"Hi @Bob, this is **bold** and `code` with a\\_b 😄\n" +
+		"[_docs_](https://example.com/docs)\n" +
+		"- one\n" +
+		"  3. nested\n" +
+		"  4. again\n" +
+		"- two\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n" +
+		"> ⚠️ Careful\n" +
+		"> `IN REVIEW`\n" +
+		"| Env | State |\n" +
+		"| **prod** | down |\n" +
+		"📎 screenshot.png\n" +
+		"See <https://example.atlassian.net/browse/PRJ-1> due <t:1700000000:D>\n" +
+		"---\n" +
+		"> quoted"
+	if got := ADFToMarkdown(doc, nil); got != want {
+		t.Fatalf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestADFMentionMapping(t *testing.T) {
+	users, err := utils.ParseUserMapping([]byte("jira_to_discord:\n  - accountId: acc-bob\n    displayName: Bob\n    discordId: \"42\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &ADFNode{Type: "doc", Content: []ADFNode{{Type: "paragraph", Content: []ADFNode{
+		{Type: "mention", Attrs: map[string]any{"id": "acc-bob", "text": "@Bob"}},
+	}}}}
+	if got := ADFToMarkdown(doc, users); got != "<@42>" {
+		t.Fatalf("unexpected mention: %q", got)
+	}
+}
+
+func TestToDiscordMessageADF(t *testing.T) {
+	w := loadWebhook(t, "adf_comment.json")
+	if got, _ := fieldValue(t, w, "Comment"); got != "Fixed in `main`" {
+		t.Fatalf("unexpected comment: %q", got)
+	}
+
+	w = loadWebhook(t, "adf_issue.json")
+	if got, _ := fieldValue(t, w, "Description"); !strings.HasPrefix(got, "## Steps\nHi @Bob") {
+		t.Fatalf("unexpected description: %q", got)
+	}
+}
+
+func TestTextJSON(t *testing.T) {
+	w := loadWebhook(t, "adf_comment.json")
+	if w.Issue.Fields.Description != "" {
+		t.Fatalf("null description should decode as empty, got %q", w.Issue.Fields.Description)
+	}
+	b, err := json.Marshal(w.Comment)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var c Comment
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if c.Body != w.Comment.Body {
+		t.Fatalf("ADF body did not round-trip: %s", c.Body)
+	}
+	if _, ok := c.Body.ADF(); !ok {
+		t.Fatal("expected ADF body")
+	}
+
+	b, _ = json.Marshal(Comment{Body: "{code}x{code}"})
+	if err := json.Unmarshal(b, &c); err != nil || c.Body != "{code}x{code}" {
+		t.Fatalf("wiki body did not round-trip: %s %v", c.Body, err)
+	}
+	if _, ok := c.Body.ADF(); ok {
+		t.Fatal("wiki markup must not be treated as ADF")
+	}
+	if err := json.Unmarshal([]byte(`{"body": 1}`), &c); err == nil {
+		t.Fatal("expected error for a numeric body")
+	}
+}
@@ -0,0 +1,169 @@
+package jira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrAttachmentTooLarge is returned by Download for files above MaxSize.
+var ErrAttachmentTooLarge = errors.New("attachment exceeds size limit")
+
+// IsImage reports whether a is an image Discord can show in an embed.
+func (a Attachment) IsImage() bool {
+	if strings.HasPrefix(a.MimeType, "image/") {
+		return true
+	}
+	switch strings.ToLower(a.Filename[strings.LastIndexByte(a.Filename, '.')+1:]) {
+	case "png", "jpg", "jpeg", "gif", "webp":
+		return true
+	}
+	return false
+}
+
+// ReferencedAttachments returns the issue attachments referenced by the
+// text the message shows: the comment body for comment events and the
+// description otherwise. References are wiki images (!name.png!) and
+// attachment links ([^name.pdf]), or ADF media nodes, matched by file name.
+// The result is in order of first reference.
+func (w Webhook) ReferencedAttachments() []Attachment {
+	if len(w.Issue.Fields.Attachment) == 0 {
+		return nil
+	}
+	text := w.Issue.Fields.Description
+	if w.Comment != nil {
+		text = w.Comment.Body
+	}
+	var names []string
+	if doc, ok := text.ADF(); ok {
+		names = adfReferences(doc.Content, nil)
+	} else {
+		names = wikiReferences(parseWiki(string(text)).children, nil)
+	}
+	byName := make(map[string]Attachment, len(w.Issue.Fields.Attachment))
+	for _, a := range w.Issue.Fields.Attachment {
+		if _, ok := byName[a.Filename]; !ok {
+			byName[a.Filename] = a
+		}
+	}
+	var refs []Attachment
+	seen := make(map[string]bool)
+	for _, name := range names {
+		a, ok := byName[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		refs = append(refs, a)
+	}
+	return refs
+}
+
+func wikiReferences(nodes []*wikiNode, names []string) []string {
+	for _, n := range nodes {
+		switch n.kind {
+		case wikiImage, wikiAttach:
+			names = append(names, strings.TrimSpace(n.text))
+		default:
+			names = wikiReferences(n.children, names)
+		}
+	}
+	return names
+}
+
+func adfReferences(nodes []ADFNode, names []string) []string {
+	for _, n := range nodes {
+		switch n.Type {
+		case "media", "mediaInline":
+			if alt := attrString(n.Attrs, "alt"); alt != "" {
+				names = append(names, alt)
+			}
+		default:
+			names = adfReferences(n.Content, names)
+		}
+	}
+	return names
+}
+
+// AttachmentClient downloads issue attachments with Jira credentials.
+type AttachmentClient struct {
+	HTTPClient *http.Client
+	// BaseURL is the Jira site. Only attachments on its host are fetched
+	// so that credentials are never sent elsewhere.
+	BaseURL string
+	// Email and Token authenticate with basic auth as Jira Cloud expects.
+	// Without Email the token is sent as a bearer personal access token,
+	// as Jira Data Center expects.
+	Email string
+	Token string
+	// MaxSize is the largest file downloaded, in bytes.
+	MaxSize int64
+}
+
+// NewAttachmentClient returns a client for the Jira site at baseURL.
+func NewAttachmentClient(baseURL, email, token string, maxSize int64) *AttachmentClient {
+	return &AttachmentClient{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		BaseURL:    baseURL,
+		Email:      email,
+		Token:      token,
+		MaxSize:    maxSize,
+	}
+}
+
+// Download fetches the content of a.
+func (c *AttachmentClient) Download(ctx context.Context, a Attachment) ([]byte, error) {
+	if c.MaxSize > 0 && a.Size > c.MaxSize {
+		return nil, fmt.Errorf("%s: %w", a.Filename, ErrAttachmentTooLarge)
+	}
+	if err := c.checkHost(a.Content); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.Content, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Email != "" {
+		req.SetBasicAuth(c.Email, c.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: jira returned status %d", a.Filename, resp.StatusCode)
+	}
+	body := io.Reader(resp.Body)
+	if c.MaxSize > 0 {
+		body = io.LimitReader(resp.Body, c.MaxSize+1)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxSize > 0 && int64(len(b)) > c.MaxSize {
+		return nil, fmt.Errorf("%s: %w", a.Filename, ErrAttachmentTooLarge)
+	}
+	return b, nil
+}
+
+// checkHost rejects URLs outside the Jira site.
+func (c *AttachmentClient) checkHost(rawURL string) error {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || base.Host == "" {
+		return errors.New("attachment download requires a Jira base URL")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != base.Scheme || !strings.EqualFold(u.Host, base.Host) {
+		return fmt.Errorf("attachment url %q is not on %s", rawURL, base.Host)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package jira
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func attachmentWebhook(description Text) Webhook {
+	var w Webhook
+	w.Issue.Fields.Description = description
+	w.Issue.Fields.Attachment = []Attachment{
+		{Filename: "report.pdf", Content: "https://jira.example.com/a/1"},
+		{Filename: "shot.png", MimeType: "image/png", Content: "https://jira.example.com/a/2"},
+		{Filename: "unused.txt", Content: "https://jira.example.com/a/3"},
+	}
+	return w
+}
+
+func TestReferencedAttachments(t *testing.T) {
+	w := attachmentWebhook("See !shot.png|thumbnail! and [^report.pdf], again !shot.png! and [^gone.zip]")
+	got := w.ReferencedAttachments()
+	if len(got) != 2 || got[0].Filename != "shot.png" || got[1].Filename != "report.pdf" {
+		t.Fatalf("unexpected attachments: %+v", got)
+	}
+
+	w.Comment = &Comment{Body: "{quote}[^report.pdf]{quote}"}
+	if got := w.ReferencedAttachments(); len(got) != 1 || got[0].Filename != "report.pdf" {
+		t.Fatalf("comment events should use the comment body, got %+v", got)
+	}
+
+	adf := attachmentWebhook(`{"type":"doc","content":[{"type":"mediaSingle","content":[{"type":"media","attrs":{"type":"file","alt":"shot.png"}}]}]}`)
+	if got := adf.ReferencedAttachments(); len(got) != 1 || got[0].Filename != "shot.png" || !got[0].IsImage() {
+		t.Fatalf("unexpected ADF attachments: %+v", got)
+	}
+}
+
+func TestAttachmentClientDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 8)))
+	}))
+	defer srv.Close()
+	c := NewAttachmentClient(srv.URL+"/browse", "bot@example.com", "token", 8)
+	ctx := context.Background()
+
+	b, err := c.Download(ctx, Attachment{Filename: "a.txt", Content: srv.URL + "/a"})
+	if err != nil || string(b) != "xxxxxxxx" {
+		t.Fatalf("Download: %q, %v", b, err)
+	}
+	c.MaxSize = 4
+	if _, err := c.Download(ctx, Attachment{Filename: "a.txt", Content: srv.URL + "/a"}); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("expected size error, got %v", err)
+	}
+	if _, err := c.Download(ctx, Attachment{Filename: "a.txt", Size: 5, Content: srv.URL + "/a"}); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("expected size error from metadata, got %v", err)
+	}
+	if _, err := c.Download(ctx, Attachment{Filename: "a.txt", Content: "https://elsewhere.example.com/a"}); err == nil {
+		t.Fatal("expected an error for a URL outside the Jira site")
+	}
+}
@@ -2,9 +2,8 @@ package jira
 
 import (
 	"fmt"
-	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"jira-discord-webhook/internal/discord"
 	"jira-discord-webhook/internal/utils"
@@ -15,21 +14,25 @@ const (
 	commentColor          = 0x347433
 	changelogColor        = 0xFF6F3C
 	commentChangelogColor = 0x5409DA
+	deletedColor          = 0xD83C3E
 )
 
-// colorFromEnv returns the color defined in the given environment variable. If
-// the variable is empty or invalid, def is returned.
-func colorFromEnv(name string, def int) int {
-	val := os.Getenv(name)
-	if val == "" {
-		return def
-	}
-	val = strings.TrimPrefix(val, "#")
-	v, err := strconv.ParseInt(val, 0, 32)
-	if err != nil {
-		return def
-	}
-	return int(v)
+// Colors are the embed colors of each kind of event.
+type Colors struct {
+	Issue            int
+	Comment          int
+	Changelog        int
+	CommentChangelog int
+	Deleted          int
+}
+
+// DefaultColors are used when RenderOptions leaves Colors unset.
+var DefaultColors = Colors{
+	Issue:            issueColor,
+	Comment:          commentColor,
+	Changelog:        changelogColor,
+	CommentChangelog: commentChangelogColor,
+	Deleted:          deletedColor,
 }
 
 // Capitalize returns s with the first letter upper-cased.
@@ -40,120 +43,199 @@ func Capitalize(s string) string {
 	return strings.ToUpper(s[:1]) + strings.ToLower(s[1:])
 }
 
-// truncateString ensures a string does not exceed max length.
+// truncateString shortens the plain text s to at most max characters,
+// counted in runes as Discord does, ending with "…" when cut.
 func truncateString(s string, max int) string {
-	if len(s) > max {
-		return s[:max]
+	r := []rune(s)
+	if max <= 0 || len(r) <= max {
+		return s
 	}
-	return s
+	return string(r[:max-1]) + "…"
 }
 
-// ToDiscordMessage converts a Jira webhook payload into a Discord message.
-func ToDiscordMessage(w Webhook, baseURL string) discord.WebhookMessage {
-	issueURL := ""
-	if baseURL != "" {
-		issueURL = fmt.Sprintf("%s/%s", strings.TrimRight(baseURL, "/"), w.Issue.Key)
+// Discord embed limits
+const (
+	titleMax      = 256
+	descMax       = 4096
+	fieldNameMax  = 256
+	fieldValueMax = 1024
+	authorNameMax = 256
+	footerTextMax = 2048
+	maxFields     = 25
+)
+
+// issueURL returns the link to w's issue, or "" without a base URL.
+func issueURL(w Webhook, baseURL string) string {
+	if baseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimRight(baseURL, "/"), w.Issue.Key)
+}
+
+// eventColor returns the embed color for the kind of event.
+func eventColor(w Webhook, ev Event, colors Colors) int {
+	switch {
+	case ev == EventIssueDeleted || ev == EventCommentDeleted:
+		return colors.Deleted
+	case w.Comment != nil && w.Changelog != nil:
+		return colors.CommentChangelog
+	case w.Comment != nil:
+		return colors.Comment
+	case w.Changelog != nil:
+		return colors.Changelog
+	default:
+		return colors.Issue
+	}
+}
+
+// eventTimestamp returns the event time in ISO 8601, or "" when unknown.
+func eventTimestamp(w Webhook) string {
+	t := w.Time()
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// actorAuthor shows the user who triggered the event with their avatar.
+func actorAuthor(w Webhook) *discord.Author {
+	u := w.ActorUser()
+	if u == nil {
+		return nil
+	}
+	return &discord.Author{Name: truncateString(u.DisplayName, authorNameMax), IconURL: u.Avatar()}
+}
+
+// projectFooter names the issue's project, with its avatar when known.
+func projectFooter(w Webhook) *discord.Footer {
+	p := w.Issue.Fields.Project
+	name := p.Name
+	if name == "" {
+		name = p.Key
+	}
+	if name == "" {
+		return nil
+	}
+	return &discord.Footer{Text: truncateString(name, footerTextMax), IconURL: avatar(p.AvatarURLs)}
+}
+
+// formatText converts Jira markup or an ADF document to Discord markdown
+// with the mentions of users, rendering tables in the given style.
+func formatText(t Text, tables TableStyle, users *utils.UserMapping) string {
+	if tables == "" {
+		tables = DefaultTableStyle
 	}
+	if doc, ok := t.ADF(); ok {
+		return ADFToMarkdownStyle(doc, tables, users)
+	}
+	s := utils.ProtectDomains(string(t))
+	s = users.ReplaceMentions(s)
+	return JiraToMarkdownStyle(s, tables)
+}
 
-	// Discord embed limits
-	const (
-		titleMax      = 256
-		descMax       = 4096
-		fieldNameMax  = 256
-		fieldValueMax = 1024
-		maxFields     = 25
-	)
+// changeLines describes each changelog item, e.g. "Status: Open → Done",
+// with users mentioned.
+func changeLines(w Webhook, users *utils.UserMapping) []string {
+	if w.Changelog == nil {
+		return nil
+	}
+	var changes []string
+	for _, item := range w.Changelog.Items {
+		if item.FromString == "" && item.ToString == "" {
+			continue
+		}
+		name := Capitalize(item.Field)
+		if strings.ToLower(item.Field) == "status" {
+			name = "Status"
+		}
+		from := JiraToMarkdown(item.FromString)
+		to := JiraToMarkdown(item.ToString)
+		var change string
+		if item.FromString == "" {
+			change = fmt.Sprintf("%s set to %s", name, users.Mention(to))
+		} else {
+			change = fmt.Sprintf("%s: %s → %s", name, users.Mention(from), users.Mention(to))
+		}
+		changes = append(changes, discord.Truncate(change, fieldValueMax, ""))
+	}
+	return changes
+}
 
+// ToDiscordMessage converts a Jira webhook payload into a Discord message.
+func ToDiscordMessage(w Webhook, baseURL string) discord.WebhookMessage {
+	return toDiscordMessage(w, baseURL, RenderOptions{}.withDefaults())
+}
+
+func toDiscordMessage(w Webhook, baseURL string, opts RenderOptions) discord.WebhookMessage {
+	ev, tables := w.Event(), opts.Tables
 	title := truncateString(fmt.Sprintf("%s: %s", w.Issue.Key, w.Issue.Fields.Summary), titleMax)
 	var desc string
-	if w.Comment != nil {
-		desc = ""
-	} else {
-		desc = w.Issue.Fields.Description
-		desc = utils.ProtectDomains(desc)
-		desc = utils.ReplaceJiraMentionsWithDiscord(desc)
-		desc = JiraToMarkdown(desc)
-		desc = truncateString(desc, descMax)
+	if w.Comment == nil {
+		desc = discord.Truncate(formatText(w.Issue.Fields.Description, tables, opts.Users), descMax, issueURL(w, baseURL))
 	}
 
 	embed := discord.Embed{
-		Title:       title,
-		URL:         issueURL,
-		Description: "",
+		Title:     title,
+		URL:       issueURL(w, baseURL),
+		Color:     eventColor(w, ev, opts.Colors),
+		Timestamp: eventTimestamp(w),
+		Author:    actorAuthor(w),
+		Footer:    projectFooter(w),
 	}
-	switch {
-	case w.Comment != nil && w.Changelog != nil:
-		embed.Color = colorFromEnv("COMMENT_CHANGELOG_COLOR", commentChangelogColor)
-	case w.Comment != nil:
-		embed.Color = colorFromEnv("COMMENT_COLOR", commentColor)
-	case w.Changelog != nil:
-		embed.Color = colorFromEnv("CHANGELOG_COLOR", changelogColor)
-	default:
-		embed.Color = colorFromEnv("ISSUE_COLOR", issueColor)
+	if icon := w.Issue.Fields.Issuetype.IconURL; icon != "" {
+		embed.Thumbnail = &discord.Thumbnail{URL: icon}
 	}
 
-	// Add Description as a separate field if present
+	// Add Description as a separate field if present. Values longer than a
+	// field allows continue in further fields when the message is sent.
 	if desc != "" {
 		embed.Fields = append(embed.Fields, discord.Field{
 			Name:   truncateString("Description", fieldNameMax),
-			Value:  truncateString(desc, fieldValueMax),
+			Value:  desc,
 			Inline: false,
 		})
 	}
 
-	if w.Comment != nil {
-		commentBody := w.Comment.Body
-		commentBody = utils.ProtectDomains(commentBody)
-		fmt.Println("[DEBUG] After ProtectDomains:", commentBody)
-		commentBody = utils.ReplaceJiraMentionsWithDiscord(commentBody)
-		fmt.Println("[DEBUG] After ReplaceJiraMentionsWithDiscord:", commentBody)
-		commentBody = JiraToMarkdown(commentBody)
-		fmt.Println("[DEBUG] After JiraToMarkdown:", commentBody)
-		commentBody = truncateString(commentBody, fieldValueMax)
+	if w.Comment != nil && ev != EventCommentDeleted {
+		commentName := "Comment"
+		if ev == EventCommentUpdated {
+			commentName = "Comment (edited)"
+		}
+		commentBody := discord.Truncate(formatText(w.Comment.Body, tables, opts.Users), descMax, issueURL(w, baseURL))
 		embed.Fields = append(embed.Fields, discord.Field{
-			Name:   truncateString("Comment", fieldNameMax),
+			Name:   truncateString(commentName, fieldNameMax),
 			Value:  commentBody,
 			Inline: false,
 		})
+	}
+	if w.Comment != nil {
 		embed.Fields = append(embed.Fields, discord.Field{
 			Name:   truncateString("Comment by", fieldNameMax),
-			Value:  truncateString(utils.DiscordMentionForJiraUser(w.Comment.Author.DisplayName), fieldValueMax),
+			Value:  truncateString(opts.Users.Mention(w.Comment.Author.DisplayName), fieldValueMax),
 			Inline: true,
 		})
 	}
 
-	if w.Changelog != nil && len(w.Changelog.Items) > 0 {
-		var changes []string
-		for _, item := range w.Changelog.Items {
-			if item.FromString == "" && item.ToString == "" {
-				continue
-			}
-			name := Capitalize(item.Field)
-			if strings.ToLower(item.Field) == "status" {
-				name = "Status"
-			}
-			from := JiraToMarkdown(item.FromString)
-			to := JiraToMarkdown(item.ToString)
-			var change string
-			if item.FromString == "" {
-				change = fmt.Sprintf("%s set to %s", name, utils.DiscordMentionForJiraUser(to))
-			} else {
-				change = fmt.Sprintf("%s: %s → %s", name, utils.DiscordMentionForJiraUser(from), utils.DiscordMentionForJiraUser(to))
-			}
-			changes = append(changes, truncateString(change, fieldValueMax))
-		}
-		if len(changes) > 0 {
-			field := discord.Field{
-				Name:  truncateString("Changes", fieldNameMax),
-				Value: truncateString(strings.Join(changes, "\n"), fieldValueMax),
-			}
-			embed.Fields = append(embed.Fields, field)
+	if changes := changeLines(w, opts.Users); len(changes) > 0 {
+		embed.Fields = append(embed.Fields, discord.Field{
+			Name:  truncateString("Changes", fieldNameMax),
+			Value: discord.Truncate(strings.Join(changes, "\n"), descMax, issueURL(w, baseURL)),
+		})
+	}
+
+	if label := actorLabel(ev); label != "" {
+		if actor := w.Actor(); actor != "" {
+			embed.Fields = append(embed.Fields, discord.Field{
+				Name:   label,
+				Value:  truncateString(opts.Users.Mention(actor), fieldValueMax),
+				Inline: true,
+			})
 		}
 	}
 
 	// Inline fields: show as plain text, no markdown link
 	embed.Fields = append(embed.Fields, discord.Field{Name: "Priority", Value: truncateString(w.Issue.Fields.Priority.Name, fieldValueMax), Inline: true})
-	embed.Fields = append(embed.Fields, discord.Field{Name: "Assignee", Value: truncateString(utils.DiscordMentionForJiraUser(w.Issue.Fields.Assignee.DisplayName), fieldValueMax), Inline: true})
+	embed.Fields = append(embed.Fields, discord.Field{Name: "Assignee", Value: truncateString(opts.Users.Mention(w.Issue.Fields.Assignee.DisplayName), fieldValueMax), Inline: true})
 	embed.Fields = append(embed.Fields, discord.Field{Name: "Status", Value: truncateString(w.Issue.Fields.Status.Name, fieldValueMax), Inline: true})
 	embed.Fields = append(embed.Fields, discord.Field{Name: "Type", Value: truncateString(w.Issue.Fields.Issuetype.Name, fieldValueMax), Inline: true})
 
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func loadWebhook(t *testing.T, name string) Webhook {
@@ -22,7 +23,6 @@ func loadWebhook(t *testing.T, name string) Webhook {
 }
 
 func TestToDiscordMessageIssue(t *testing.T) {
-	os.Unsetenv("ISSUE_COLOR")
 	w := loadWebhook(t, "issue.json")
 	msg := ToDiscordMessage(w, "https://example.com/browse")
 	if msg.Embeds[0].Title != "PRJ-1: Test issue" {
@@ -37,7 +37,6 @@ func TestToDiscordMessageIssue(t *testing.T) {
 }
 
 func TestToDiscordMessageComment(t *testing.T) {
-	os.Unsetenv("COMMENT_COLOR")
 	w := loadWebhook(t, "comment.json")
 	msg := ToDiscordMessage(w, "")
 	var found bool
@@ -55,7 +54,6 @@ func TestToDiscordMessageComment(t *testing.T) {
 }
 
 func TestToDiscordMessageChangelog(t *testing.T) {
-	os.Unsetenv("CHANGELOG_COLOR")
 	w := loadWebhook(t, "changelog.json")
 	msg := ToDiscordMessage(w, "")
 	var found bool
@@ -74,7 +72,6 @@ func TestToDiscordMessageChangelog(t *testing.T) {
 }
 
 func TestToDiscordMessageCommentChangelog(t *testing.T) {
-	os.Unsetenv("COMMENT_CHANGELOG_COLOR")
 	w := loadWebhook(t, "comment_changelog.json")
 	msg := ToDiscordMessage(w, "")
 	var hasAuthor, hasChange bool
@@ -94,13 +91,13 @@ func TestToDiscordMessageCommentChangelog(t *testing.T) {
 	}
 }
 
-func TestToDiscordMessageColorFromEnv(t *testing.T) {
-	os.Setenv("ISSUE_COLOR", "0x123456")
-	defer os.Unsetenv("ISSUE_COLOR")
+func TestRenderMessageColors(t *testing.T) {
+	colors := DefaultColors
+	colors.Issue = 0x123456
 	w := loadWebhook(t, "issue.json")
-	msg := ToDiscordMessage(w, "")
+	msg := RenderMessage(w, "", RenderOptions{Colors: colors})
 	if msg.Embeds[0].Color != 0x123456 {
-		t.Fatalf("env color not applied")
+		t.Fatalf("configured color not applied")
 	}
 }
 
@@ -123,16 +120,34 @@ func TestToDiscordMessageLongFields(t *testing.T) {
 		Issue: Issue{Key: long},
 	}
 	w.Issue.Fields.Summary = long
-	w.Issue.Fields.Description = long
+	w.Issue.Fields.Description = Text(long)
 	msg := ToDiscordMessage(w, "")
-	if len(msg.Embeds[0].Title) > 256 {
+	if utf8.RuneCountInString(msg.Embeds[0].Title) > 256 {
 		t.Fatalf("title too long")
 	}
-	if len(msg.Embeds[0].Description) > 4096 {
+	if utf8.RuneCountInString(msg.Embeds[0].Description) > 4096 {
 		t.Fatalf("description too long")
 	}
 }
 
+func TestToDiscordMessageTruncatesDescription(t *testing.T) {
+	w := Webhook{Issue: Issue{Key: "PRJ-1"}}
+	w.Issue.Fields.Summary = strings.Repeat("ภาษาไทย", 50)
+	w.Issue.Fields.Description = Text("{code}\n" + strings.Repeat("ข้อความ ", 700) + "\n{code}")
+	msg := ToDiscordMessage(w, "https://jira.example.com/browse")
+	title := msg.Embeds[0].Title
+	if !utf8.ValidString(title) || utf8.RuneCountInString(title) != 256 || !strings.HasSuffix(title, "…") {
+		t.Fatalf("unexpected title: %q", title)
+	}
+	desc := msg.Embeds[0].Fields[0].Value
+	if !utf8.ValidString(desc) || utf8.RuneCountInString(desc) > 4096 {
+		t.Fatalf("description not cut to 4096 characters")
+	}
+	if !strings.HasSuffix(desc, "\n```\n… [Read more](https://jira.example.com/browse/PRJ-1)") {
+		t.Fatalf("expected closed code block and read more link, got %q", desc[len(desc)-80:])
+	}
+}
+
 func TestToDiscordMessageEmptyCommentBody(t *testing.T) {
 	w := Webhook{
 		Issue:   Issue{Key: "PRJ-EMPTY-COMMENT"},
@@ -143,3 +158,137 @@ func TestToDiscordMessageEmptyCommentBody(t *testing.T) {
 		t.Fatalf("expected empty description for empty comment body")
 	}
 }
+
+// fieldValue returns the value of the named field in the first embed.
+func fieldValue(t *testing.T, w Webhook, name string) (string, bool) {
+	t.Helper()
+	msg := ToDiscordMessage(w, "")
+	for _, f := range msg.Embeds[0].Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestToDiscordMessageEvents(t *testing.T) {
+	tests := []struct {
+		file       string
+		event      Event
+		actorField string
+		actor      string
+		color      int
+	}{
+		{"issue_created.json", EventIssueCreated, "Created by", "Alice", issueColor},
+		{"issue_deleted.json", EventIssueDeleted, "Deleted by", "Carol", deletedColor},
+		{"issue_assigned.json", EventIssueAssigned, "Assigned by", "Carol", changelogColor},
+		{"issue_generic.json", EventIssueGeneric, "Updated by", "Carol", changelogColor},
+		{"comment_updated.json", EventCommentUpdated, "Edited by", "Dave", commentColor},
+		{"comment_deleted.json", EventCommentDeleted, "Deleted by", "Carol", deletedColor},
+	}
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			w := loadWebhook(t, tc.file)
+			if got := w.Event(); got != tc.event {
+				t.Fatalf("event: got %s, want %s", got, tc.event)
+			}
+			if got, ok := fieldValue(t, w, tc.actorField); !ok || got != tc.actor {
+				t.Fatalf("%s: got %q (present %v), want %q", tc.actorField, got, ok, tc.actor)
+			}
+			if got := ToDiscordMessage(w, "").Embeds[0].Color; got != tc.color {
+				t.Fatalf("unexpected color: %#x", got)
+			}
+		})
+	}
+}
+
+func TestToDiscordMessageCommentEdited(t *testing.T) {
+	w := loadWebhook(t, "comment_updated.json")
+	if got, ok := fieldValue(t, w, "Comment (edited)"); !ok || got != "fixed typo" {
+		t.Fatalf("expected edited comment body, got %q", got)
+	}
+	if got, _ := fieldValue(t, w, "Comment by"); got != "Alice" {
+		t.Fatalf("expected original comment author, got %q", got)
+	}
+}
+
+func TestToDiscordMessageCommentDeletedHidesBody(t *testing.T) {
+	w := loadWebhook(t, "comment_deleted.json")
+	if _, ok := fieldValue(t, w, "Comment"); ok {
+		t.Fatal("deleted comment body should not be shown")
+	}
+}
+
+func TestWebhookEventFallback(t *testing.T) {
+	if got := (Webhook{}).Event(); got != EventUnknown {
+		t.Errorf("empty payload: got %s", got)
+	}
+	if got := (Webhook{Comment: &Comment{}}).Event(); got != EventCommentCreated {
+		t.Errorf("comment payload: got %s", got)
+	}
+	if got := (Webhook{Changelog: &Changelog{}}).Event(); got != EventIssueUpdated {
+		t.Errorf("changelog payload: got %s", got)
+	}
+	w := Webhook{WebhookEvent: "jira:issue_updated", IssueEventTypeName: "issue_commented", Comment: &Comment{}}
+	if got := w.Event(); got != EventCommentCreated {
+		t.Errorf("issue_commented: got %s", got)
+	}
+}
+
+func TestWebhookTime(t *testing.T) {
+	w := loadWebhook(t, "issue_created.json")
+	if got := w.Time().UTC().Format("2006-01-02"); got != "2025-06-23" {
+		t.Errorf("unexpected time: %s", got)
+	}
+	if !(Webhook{}).Time().IsZero() {
+		t.Error("expected zero time without timestamp")
+	}
+}
+
+func TestWebhookFingerprint(t *testing.T) {
+	comment := func(id string, body Text, author string) *Comment {
+		c := &Comment{ID: id, Body: body}
+		c.Author.DisplayName = author
+		return c
+	}
+	updated := Webhook{WebhookEvent: "jira:issue_updated", IssueEventTypeName: "issue_commented", Timestamp: 1, Issue: Issue{Key: "PRJ-1"}, Comment: comment("1", "hi", "Alice")}
+	created := Webhook{WebhookEvent: "comment_created", Timestamp: 2, Issue: Issue{Key: "PRJ-1"}, Comment: comment("1", "hi", "Alice")}
+	if updated.Fingerprint() != created.Fingerprint() {
+		t.Error("issue_commented and comment_created for the same comment should match")
+	}
+	edited := Webhook{WebhookEvent: "comment_updated", Issue: Issue{Key: "PRJ-1"}, Comment: comment("1", "hi!", "Alice")}
+	if edited.Fingerprint() == created.Fingerprint() {
+		t.Error("edited comment should not match the original")
+	}
+	other := loadWebhook(t, "changelog.json")
+	again := loadWebhook(t, "changelog.json")
+	if other.Fingerprint() != again.Fingerprint() {
+		t.Error("identical payloads should match")
+	}
+	again.Changelog.Items[0].ToString = "Reopened"
+	if other.Fingerprint() == again.Fingerprint() {
+		t.Error("different changes should not match")
+	}
+}
+
+func TestToDiscordMessageEmbedDetails(t *testing.T) {
+	w := loadWebhook(t, "issue_created.json")
+	e := ToDiscordMessage(w, "").Embeds[0]
+	if e.Author == nil || e.Author.Name != "Alice" || e.Author.IconURL != "https://example.com/avatar/alice-48.png" {
+		t.Errorf("unexpected author: %+v", e.Author)
+	}
+	if e.Thumbnail == nil || e.Thumbnail.URL != "https://example.com/icons/bug.png" {
+		t.Errorf("unexpected thumbnail: %+v", e.Thumbnail)
+	}
+	if e.Footer == nil || e.Footer.Text != "Project" || e.Footer.IconURL != "https://example.com/project-32.png" {
+		t.Errorf("unexpected footer: %+v", e.Footer)
+	}
+	if e.Timestamp != "2025-06-23T08:00:00Z" {
+		t.Errorf("unexpected timestamp: %q", e.Timestamp)
+	}
+
+	e = ToDiscordMessage(loadWebhook(t, "issue.json"), "").Embeds[0]
+	if e.Author != nil || e.Thumbnail != nil || e.Footer != nil || e.Timestamp != "" {
+		t.Errorf("expected no details without actor, icon, project or time: %+v", e)
+	}
+}
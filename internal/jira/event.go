@@ -0,0 +1,143 @@
+package jira
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Event identifies the kind of change a webhook describes.
+type Event string
+
+const (
+	EventUnknown        Event = "unknown"
+	EventIssueCreated   Event = "issue_created"
+	EventIssueUpdated   Event = "issue_updated"
+	EventIssueDeleted   Event = "issue_deleted"
+	EventIssueAssigned  Event = "issue_assigned"
+	EventIssueGeneric   Event = "issue_generic"
+	EventCommentCreated Event = "comment_created"
+	EventCommentUpdated Event = "comment_updated"
+	EventCommentDeleted Event = "comment_deleted"
+)
+
+// issueEventTypes maps Jira's issue_event_type_name values to events.
+var issueEventTypes = map[string]Event{
+	"issue_created":         EventIssueCreated,
+	"issue_updated":         EventIssueUpdated,
+	"issue_deleted":         EventIssueDeleted,
+	"issue_assigned":        EventIssueAssigned,
+	"issue_generic":         EventIssueGeneric,
+	"issue_commented":       EventCommentCreated,
+	"issue_comment_edited":  EventCommentUpdated,
+	"issue_comment_deleted": EventCommentDeleted,
+}
+
+// Event returns the kind of event w describes. The issue_event_type_name
+// field is more specific than webhookEvent and is preferred when present.
+// Payloads without either field are classified by their comment and
+// changelog, as older Jira versions and hand-written payloads omit them.
+func (w Webhook) Event() Event {
+	if ev, ok := issueEventTypes[w.IssueEventTypeName]; ok {
+		return ev
+	}
+	switch w.WebhookEvent {
+	case "jira:issue_created":
+		return EventIssueCreated
+	case "jira:issue_updated":
+		return EventIssueUpdated
+	case "jira:issue_deleted":
+		return EventIssueDeleted
+	case "comment_created":
+		return EventCommentCreated
+	case "comment_updated":
+		return EventCommentUpdated
+	case "comment_deleted":
+		return EventCommentDeleted
+	}
+	switch {
+	case w.Comment != nil:
+		return EventCommentCreated
+	case w.Changelog != nil:
+		return EventIssueUpdated
+	}
+	return EventUnknown
+}
+
+// Time returns the event time, or the zero time if the payload has none.
+func (w Webhook) Time() time.Time {
+	if w.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(w.Timestamp)
+}
+
+// Actor returns the display name of the user that triggered the event.
+func (w Webhook) Actor() string {
+	if u := w.ActorUser(); u != nil {
+		return u.DisplayName
+	}
+	return ""
+}
+
+// ActorUser returns the user that triggered the event, or nil when the
+// payload does not say.
+func (w Webhook) ActorUser() *User {
+	if w.User != nil && w.User.DisplayName != "" {
+		return w.User
+	}
+	if w.Comment == nil {
+		return nil
+	}
+	switch w.Event() {
+	case EventCommentCreated:
+		if w.Comment.Author.DisplayName != "" {
+			return &w.Comment.Author
+		}
+	case EventCommentUpdated:
+		if w.Comment.UpdateAuthor != nil && w.Comment.UpdateAuthor.DisplayName != "" {
+			return w.Comment.UpdateAuthor
+		}
+	}
+	return nil
+}
+
+// Fingerprint returns a hash of the parts of w that describe the change:
+// the event kind, issue key, comment and changelog. Jira retries and the
+// issue_updated/comment_created pair fired for a single comment share a
+// fingerprint, while unrelated changes to the same issue do not.
+func (w Webhook) Fingerprint() string {
+	key := struct {
+		Event     Event
+		Issue     string
+		Comment   *Comment   `json:",omitempty"`
+		Changelog *Changelog `json:",omitempty"`
+	}{w.Event(), w.Issue.Key, w.Comment, w.Changelog}
+	if key.Comment != nil {
+		// Only the comment content identifies the change; edits are
+		// attributed to different users in different payloads.
+		key.Comment = &Comment{ID: w.Comment.ID, Body: w.Comment.Body}
+	}
+	b, _ := json.Marshal(key)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// actorLabel returns the field name used to show who triggered ev, or ""
+// when the event is already attributed elsewhere in the embed.
+func actorLabel(ev Event) string {
+	switch ev {
+	case EventIssueCreated:
+		return "Created by"
+	case EventIssueDeleted, EventCommentDeleted:
+		return "Deleted by"
+	case EventIssueAssigned:
+		return "Assigned by"
+	case EventIssueUpdated, EventIssueGeneric:
+		return "Updated by"
+	case EventCommentUpdated:
+		return "Edited by"
+	}
+	return ""
+}
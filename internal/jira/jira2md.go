@@ -1,286 +1,198 @@
-// Force rebuild: 2025-06-23
 package jira
 
 import (
-	"regexp"
+	"strconv"
 	"strings"
 )
 
 // JiraToMarkdown converts Jira wiki markup to Markdown/Discord formatting.
 // Example: [text|http://example.com] => [text](http://example.com)
 func JiraToMarkdown(s string) string {
-	// Convert {code} and {noformat} blocks to fenced code blocks first so
-	// their contents are not processed by other transformations.
-	codeBlockRE := regexp.MustCompile(`(?s)\{code(?::([a-zA-Z0-9_+-]+))?\}(.*?)\{code\}`)
-	s = codeBlockRE.ReplaceAllStringFunc(s, func(m string) string {
-		parts := codeBlockRE.FindStringSubmatch(m)
-		lang := parts[1]
-		content := strings.TrimSpace(parts[2])
-		if lang != "" {
-			return "```" + lang + "\n" + content + "\n```"
+	return JiraToMarkdownStyle(s, TableMarkdown)
+}
+
+// JiraToMarkdownStyle is JiraToMarkdown with tables rendered in the given
+// style.
+func JiraToMarkdownStyle(s string, tables TableStyle) string {
+	var b strings.Builder
+	renderBlocks(&b, parseWiki(s).children, tables)
+	return b.String()
+}
+
+// renderBlocks writes block nodes. Lines are separated by the line breaks
+// of the input, which wikiLine nodes reproduce; block macros are written
+// where they appeared.
+func renderBlocks(b *strings.Builder, nodes []*wikiNode, tables TableStyle) {
+	for i, n := range nodes {
+		if i > 0 && needsNewline(nodes[i-1], n) {
+			b.WriteByte('\n')
 		}
-		return "```\n" + content + "\n```"
-	})
-	noformatRE := regexp.MustCompile(`(?s)\{noformat\}(.*?)\{noformat\}`)
-	s = noformatRE.ReplaceAllStringFunc(s, func(m string) string {
-		parts := noformatRE.FindStringSubmatch(m)
-		content := strings.TrimSpace(parts[1])
-		return "```\n" + content + "\n```"
-	})
-	// Helper: split into code and non-code segments
-	type segment struct {
-		text   string
-		isCode bool
+		renderBlock(b, n, tables)
 	}
-	segments := make([]segment, 0)
-	var buf strings.Builder
-	inCode := false
-	codeDelim := ""
-	for i := 0; i < len(s); {
-		if !inCode && strings.HasPrefix(s[i:], "```") {
-			if buf.Len() > 0 {
-				segments = append(segments, segment{buf.String(), false})
-				buf.Reset()
-			}
-			inCode = true
-			codeDelim = "```"
-			buf.WriteString("```")
-			i += 3
-			continue
+}
+
+// needsNewline reports whether a line break separates two blocks. Text
+// next to a block macro keeps its own line breaks.
+func needsNewline(prev, next *wikiNode) bool {
+	return !isMacro(prev) && !isMacro(next)
+}
+
+func isMacro(n *wikiNode) bool {
+	switch n.kind {
+	case wikiRaw, wikiCodeBlock, wikiQuote, wikiPanel:
+		return true
+	}
+	return false
+}
+
+func renderBlock(b *strings.Builder, n *wikiNode, tables TableStyle) {
+	switch n.kind {
+	case wikiRaw:
+		b.WriteString(n.text)
+	case wikiCodeBlock:
+		b.WriteString("```" + n.attr + "\n" + n.text + "\n```")
+	case wikiQuote:
+		b.WriteString(prefixLines(renderString(n.children, tables), "> "))
+	case wikiPanel:
+		body := prefixLines(renderString(n.children, tables), "> ")
+		if n.attr != "" {
+			body = "> **" + n.attr + "**\n" + body
 		}
-		if !inCode && strings.HasPrefix(s[i:], "`") {
-			if buf.Len() > 0 {
-				segments = append(segments, segment{buf.String(), false})
-				buf.Reset()
+		b.WriteString(body)
+	case wikiLine:
+		renderInlines(b, n.children)
+	case wikiHeading:
+		b.WriteString(strings.Repeat("#", n.level) + " ")
+		renderInlines(b, n.children)
+	case wikiBlockquote:
+		b.WriteString("> ")
+		renderInlines(b, n.children)
+	case wikiRule:
+		b.WriteString("---")
+	case wikiList:
+		renderList(b, n, "")
+	case wikiTable:
+		rows := make([][]tableCell, len(n.children))
+		header := len(n.children) > 0
+		for i, row := range n.children {
+			rows[i] = make([]tableCell, len(row.children))
+			for j, cell := range row.children {
+				rows[i][j] = tableCell{text: inlineString(cell.children), plain: plainString(cell.children)}
+				if i == 0 && !cell.header {
+					header = false
+				}
 			}
-			inCode = true
-			codeDelim = "`"
-			buf.WriteByte('`')
-			i++
-			continue
 		}
-		if inCode && strings.HasPrefix(s[i:], codeDelim) {
-			buf.WriteString(codeDelim)
-			i += len(codeDelim)
-			segments = append(segments, segment{buf.String(), true})
-			buf.Reset()
-			inCode = false
-			codeDelim = ""
-			continue
-		}
-		buf.WriteByte(s[i])
-		i++
-	}
-	if buf.Len() > 0 {
-		segments = append(segments, segment{buf.String(), inCode})
+		b.WriteString(renderTable(rows, header, tables))
 	}
+}
 
-	for i, seg := range segments {
-		if seg.isCode {
-			continue
+func renderString(nodes []*wikiNode, tables TableStyle) string {
+	var b strings.Builder
+	renderBlocks(&b, nodes, tables)
+	return b.String()
+}
+
+// renderList writes a list with nested lists indented under the text of
+// their item, as Discord requires. Numbered items count up from 1 at each
+// level.
+func renderList(b *strings.Builder, list *wikiNode, indent string) {
+	for i, item := range list.children {
+		if i > 0 {
+			b.WriteByte('\n')
 		}
-		// Links: [text|url] -> [text](url), but remove protocol from text if text is a URL
-		jiraLinkRE := regexp.MustCompile(`\[(.+?)\|([^\]]+)\]`)
-		seg.text = jiraLinkRE.ReplaceAllStringFunc(seg.text, func(m string) string {
-			parts := jiraLinkRE.FindStringSubmatch(m)
-			if len(parts) == 3 {
-				text := parts[1]
-				url := parts[2]
-				// If text is a URL, strip protocol
-				if strings.HasPrefix(text, "http://") {
-					text = text[len("http://"):]
-				} else if strings.HasPrefix(text, "https://") {
-					text = text[len("https://"):]
-				}
-				return "[" + text + "](" + url + ")"
-			}
-			return m
-		})
-		// Underline: _text_ -> __text__ (run first)
-		seg.text = regexp.MustCompile(`_([^_\n]+)_`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			if len(m) > 2 && m[0] == '_' && m[len(m)-1] == '_' {
-				return "__" + m[1:len(m)-1] + "__"
-			}
-			return m
-		})
-		// Italic: *text* -> _text_ (run second)
-		seg.text = regexp.MustCompile(`\*([^\*\n]+)\*`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			if len(m) > 2 && m[0] == '*' && m[len(m)-1] == '*' {
-				return "_" + m[1:len(m)-1] + "_"
-			}
-			return m
-		})
-		// Bold: +text+ -> **text** (run last)
-		seg.text = regexp.MustCompile(`\+([^\+\n]+)\+`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			if len(m) > 2 {
-				return "**" + m[1:len(m)-1] + "**"
-			}
-			return m
-		})
-		// Monospace: {{text}} -> `text`
-		seg.text = regexp.MustCompile(`\{\{(.*?)\}\}`).ReplaceAllString(seg.text, "`$1`")
-		// Strikethrough: -text- -> ~~text~~ (only outside code)
-		// Only match -text- that is surrounded by word boundaries and not part of a hostname or URL
-		seg.text = regexp.MustCompile(`\B-([a-zA-Z0-9][^\s-]*[a-zA-Z0-9])-\B`).ReplaceAllString(seg.text, `~~$1~~`)
-		// Headings: h1. text -> # text
-		seg.text = regexp.MustCompile(`(?m)^h([1-6])\.\s+(.+)$`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			headerRE := regexp.MustCompile(`(?m)^h([1-6])\.\s+(.+)$`)
-			parts := headerRE.FindStringSubmatch(m)
-			if len(parts) == 3 {
-				level := parts[1]
-				n := 0
-				switch level {
-				case "1":
-					n = 1
-				case "2":
-					n = 2
-				case "3":
-					n = 3
-				case "4":
-					n = 4
-				case "5":
-					n = 5
-				case "6":
-					n = 6
-				}
-				return strings.Repeat("#", n) + " " + parts[2]
-			}
-			return m
-		})
-		// Horizontal rule ---- -> ---
-		seg.text = regexp.MustCompile(`(?m)^----+\s*$`).ReplaceAllString(seg.text, "---")
-		// Bullet list: * item -> - item
-		seg.text = regexp.MustCompile(`(?m)^[ \t]*\*\s+`).ReplaceAllString(seg.text, "- ")
-		// Numbered list: # item -> 1. item
-		seg.text = regexp.MustCompile(`(?m)^[ \t]*#\s+`).ReplaceAllString(seg.text, "1. ")
-		// Blockquote: bq. text -> > text
-		seg.text = regexp.MustCompile(`(?m)^bq\.\s+`).ReplaceAllString(seg.text, "> ")
-		// Remove color markup: {color:red}text{color} -> text
-		seg.text = regexp.MustCompile(`\{color:[^}]+\}(.*?)\{color\}`).ReplaceAllString(seg.text, `$1`)
-		// {quote}...{quote} -> blockquote
-		seg.text = regexp.MustCompile(`(?s)\{quote\}(.*?)\{quote\}`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			quoteRE := regexp.MustCompile(`(?s)\{quote\}(.*?)\{quote\}`)
-			parts := quoteRE.FindStringSubmatch(m)
-			if len(parts) == 2 {
-				lines := strings.Split(strings.TrimSpace(parts[1]), "\n")
-				for i, l := range lines {
-					lines[i] = "> " + l
-				}
-				return strings.Join(lines, "\n")
-			}
-			return m
-		})
-		// {panel:title=Title}...{panel} -> > **Title**\n> ...
-		seg.text = regexp.MustCompile(`(?s)\{panel:title=([^}]*)\}(.*?)\{panel\}`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			panelRE := regexp.MustCompile(`(?s)\{panel:title=([^}]*)\}(.*?)\{panel\}`)
-			parts := panelRE.FindStringSubmatch(m)
-			if len(parts) == 3 {
-				lines := strings.Split(strings.TrimSpace(parts[2]), "\n")
-				for i, l := range lines {
-					lines[i] = "> " + l
-				}
-				return "> **" + parts[1] + "**\n" + strings.Join(lines, "\n")
-			}
-			return m
-		})
-		// Table header ||a||b|| -> | a | b |
-		seg.text = regexp.MustCompile(`(?m)^\|\|(.+?)\|\|$`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			trimmed := strings.Trim(m, "|")
-			cells := strings.Split(trimmed, "||")
-			for i, c := range cells {
-				cells[i] = strings.TrimSpace(c)
-			}
-			return "| " + strings.Join(cells, " | ") + " |"
-		})
-		// Table row |a|b| -> | a | b |
-		seg.text = regexp.MustCompile(`(?m)^\|([^|].*?)\|$`).ReplaceAllStringFunc(seg.text, func(m string) string {
-			trimmed := strings.Trim(m, "|")
-			cells := strings.Split(trimmed, "|")
-			for i, c := range cells {
-				cells[i] = strings.TrimSpace(c)
-			}
-			return "| " + strings.Join(cells, " | ") + " |"
-		})
-		// Attachment: [^file.ext] -> file.txt
-		seg.text = regexp.MustCompile(`\[\^([^\]]+)\]`).ReplaceAllString(seg.text, "$1")
-		// Image: !img.png! -> ![](img.png)
-		seg.text = regexp.MustCompile(`!([^!]+)!`).ReplaceAllString(seg.text, "![]($1)")
-		// Links: [text|url] -> [text](url)
-		jiraLinkRE = regexp.MustCompile(`\[(.+?)\|([^\]]+)\]`)
-		seg.text = jiraLinkRE.ReplaceAllStringFunc(seg.text, func(m string) string {
-			parts := jiraLinkRE.FindStringSubmatch(m)
-			if len(parts) == 3 {
-				return "[" + parts[1] + "](" + parts[2] + ")"
+		marker := "- "
+		if list.attr == "#" {
+			marker = strconv.Itoa(i+1) + ". "
+		}
+		inner := indent + strings.Repeat(" ", len(marker))
+		text := inlineString(item.children[0].children)
+		b.WriteString(indent + marker + strings.ReplaceAll(text, "\n", "\n"+inner))
+		for _, sub := range item.children[1:] {
+			b.WriteByte('\n')
+			renderList(b, sub, inner)
+		}
+	}
+}
+
+func inlineString(nodes []*wikiNode) string {
+	var b strings.Builder
+	renderInlines(&b, nodes)
+	return b.String()
+}
+
+// emphasisMarkdown maps Jira text effects to Discord markdown.
+var emphasisMarkdown = map[string]string{
+	"+": "**",
+	"*": "_",
+	"_": "__",
+	"-": "~~",
+}
+
+func renderInlines(b *strings.Builder, nodes []*wikiNode) {
+	for _, n := range nodes {
+		switch n.kind {
+		case wikiText:
+			b.WriteString(n.text)
+		case wikiEmphasis:
+			md := emphasisMarkdown[n.attr]
+			b.WriteString(md)
+			renderInlines(b, n.children)
+			b.WriteString(md)
+		case wikiMonospace:
+			b.WriteString("`" + n.text + "`")
+		case wikiCodeSpan:
+			b.WriteString(n.text)
+		case wikiLink:
+			text := inlineString(n.children)
+			// A URL used as link text is shown without its scheme.
+			for _, p := range []string{"http://", "https://"} {
+				text = strings.TrimPrefix(text, p)
 			}
-			return m
-		})
-		// Mentions: [~user] -> @user
-		seg.text = regexp.MustCompile(`\[~([^\]]+)\]`).ReplaceAllString(seg.text, "@$1")
-		// Now wrap bare domains/links in inline code, but skip inside []() and ![]() and also skip inside link text
-		// Split on Markdown links and Jira links, only wrap in non-link segments
-		// Allow for optional leading whitespace and list markers before the link/image/Jira link
-		linkOrImageOrJiraLinkRE := regexp.MustCompile(`[ \t\-*]*!?\[[^\]]*\]\([^\)]*\)|[ \t\-*]*\[[^\]|]+\|[^\]]+\]`)
-		parts := linkOrImageOrJiraLinkRE.Split(seg.text, -1)
-		matches := linkOrImageOrJiraLinkRE.FindAllStringIndex(seg.text, -1)
-		var rebuilt strings.Builder
-		for i, part := range parts {
-			// Refined: Only wrap domains that are surrounded by whitespace, start/end, or punctuation
-			urlRE := regexp.MustCompile(`(?m)(^|[\s>\(\[\{])((?:https?|ftp)://[\w\-._~:/?#\[\]@!$&'()*+,;=%]+)([\s\.,;:!?\)\]\}\n]|$)`)
-			part = urlRE.ReplaceAllStringFunc(part, func(m string) string {
-				matches := urlRE.FindStringSubmatch(m)
-				if len(matches) != 4 {
-					return m
-				}
-				prefix := matches[1]
-				url := matches[2]
-				suffix := matches[3]
-				if strings.HasPrefix(url, "`") && strings.HasSuffix(url, "`") {
-					return m // already wrapped
-				}
-				return prefix + "`" + url + "`" + suffix
-			})
-			domainRE := regexp.MustCompile(`(?m)(^|[\s>\(\[\{])([a-zA-Z0-9][a-zA-Z0-9\-]*\.[a-zA-Z]{2,})([\s\.,;:!?\)\]\}\n]|$)`)
-			part = domainRE.ReplaceAllStringFunc(part, func(m string) string {
-				matches := domainRE.FindStringSubmatch(m)
-				if len(matches) != 4 {
-					return m
-				}
-				prefix := matches[1]
-				domain := matches[2]
-				suffix := matches[3]
-				if strings.HasPrefix(domain, "`") && strings.HasSuffix(domain, "`") {
-					return m // already wrapped
-				}
-				if strings.Contains(domain, "@") {
-					return m // email
-				}
-				// Only wrap if not part of a larger word (e.g., not a-b-c-d-e.abc.com)
-				if len(prefix) > 0 && (prefix[len(prefix)-1] == '-' || prefix[len(prefix)-1] == '.') {
-					return m
-				}
-				if len(suffix) > 0 && (suffix[0] == '-' || suffix[0] == '.') {
-					return m
-				}
-				// Do not wrap if it looks like a filename (e.g., file.txt, file-1.txt)
-				filenameRE := regexp.MustCompile(`^[\w\-.]+\.[a-zA-Z0-9]+$`)
-				if filenameRE.MatchString(domain) {
-					return m
-				}
-				return prefix + "`" + domain + "`" + suffix
-			})
-			rebuilt.WriteString(part)
-			if i < len(matches) {
-				// Add the matched link/image/Jira link back untouched
-				rebuilt.WriteString(seg.text[matches[i][0]:matches[i][1]])
+			b.WriteString("[" + text + "](" + n.attr + ")")
+		case wikiMention:
+			b.WriteString("@" + n.text)
+		case wikiAttach:
+			// Referenced attachments are uploaded with the message.
+			b.WriteString("📎 " + n.text)
+		case wikiImage:
+			if isURL(n.text) {
+				b.WriteString("<" + n.text + ">")
+			} else {
+				b.WriteString("📎 " + n.text)
 			}
+		case wikiURL:
+			// Bare URLs are shown as code so Discord does not embed them.
+			b.WriteString("`" + n.text + "`")
+		case wikiBreak:
+			b.WriteByte('\n')
 		}
-		seg.text = rebuilt.String()
-		segments[i] = seg
 	}
-	// Reassemble
-	var out strings.Builder
-	for _, seg := range segments {
-		out.WriteString(seg.text)
+}
+
+// plainString renders inline nodes as text without markup, for table
+// cells shown in a code block.
+func plainString(nodes []*wikiNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.kind {
+		case wikiText:
+			if n.attr != "" {
+				b.WriteString(n.attr)
+			} else {
+				b.WriteString(n.text)
+			}
+		case wikiMonospace, wikiAttach, wikiImage, wikiURL:
+			b.WriteString(n.text)
+		case wikiEmphasis, wikiLink:
+			b.WriteString(plainString(n.children))
+		case wikiCodeSpan:
+			b.WriteString(strings.Trim(n.text, "`"))
+		case wikiMention:
+			b.WriteString("@" + n.text)
+		case wikiBreak:
+			b.WriteByte(' ')
+		}
 	}
-	return out.String()
+	return b.String()
 }
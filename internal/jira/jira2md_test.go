@@ -1,10 +1,16 @@
 package jira
 
 import (
+	"flag"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
+var update = flag.Bool("update", false, "update golden files in testdata/wiki")
+
 func TestJiraToMarkdown(t *testing.T) {
 	tests := []struct {
 		name string
@@ -35,16 +41,35 @@ func TestJiraToMarkdown(t *testing.T) {
 		{"heading", "h2. Title", "## Title"},
 		{"bullet", "* item", "- item"},
 		{"numbered", "# item", "1. item"},
+		{"numberedSequence", "# a\n# b\n# c", "1. a\n2. b\n3. c"},
+		{"nestedNumbered", "# a\n## b\n## c\n# d", "1. a\n   1. b\n   2. c\n2. d"},
+		{"mixedList", "* a\n*# b\n*# c", "- a\n  1. b\n  2. c"},
+		{"skippedLevel", "* a\n*** b", "- a\n  - b"},
 		{"hr", "----", "---"},
 		{"mention", "[~bob]", "@bob"},
-		{"attachment", "[^file.txt]", "file.txt"},
-		{"image", "!pic.png!", "![](pic.png)"},
+		{"attachment", "[^file.txt]", "📎 file.txt"},
+		{"image", "!pic.png!", "📎 pic.png"},
 		{"urlInCodeBlock", "{code}http://example.com{code}", "```\nhttp://example.com\n```"},
 		{"urlInInlineCode", "`http://example.com`", "`http://example.com`"},
 		{"formattingInNoformat", "{noformat}*bold*{noformat}", "```\n*bold*\n```"},
 		{"quote", `{quote}line1\nline2{quote}`, "> line1\n> line2"},
 		{"tableHeader", "||A||B||", "| A | B |"},
 		{"tableRow", "|1|2|", "| 1 | 2 |"},
+		{"nestedEmphasis", "*a +b+ c*", "_a **b** c_"},
+		{"escapedMarker", `\*literal\*`, `\*literal\*`},
+		{"lineBreak", `a\\b`, "a\nb"},
+		{"snakeCase", "snake_case_name", "snake_case_name"},
+		{"arithmetic", "1+2+3 and a*b*c", "1+2+3 and a*b*c"},
+		{"exclamations", "Wow! Great!", "Wow! Great!"},
+		{"imageParams", "!pic.png|thumbnail!", "📎 pic.png"},
+		{"imageURL", "!https://example.com/a.png!", "<https://example.com/a.png>"},
+		{"bareURL", "see https://example.com.", "see `https://example.com`."},
+		{"urlLink", "[http://example.com]", "[example.com](http://example.com)"},
+		{"bracketText", "[WIP] done", "[WIP] done"},
+		{"inlineCodeMacro", "run {code}make{code} now", "run ```\nmake\n``` now"},
+		{"tableCellMarkup", "|*a*|[x|http://y]|", "| _a_ | [x](http://y) |"},
+		{"unclosedCode", "{code}never closed", "{code}never closed"},
+		{"unclosedColor", "{color:red}open", "{color:red}open"},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -96,8 +121,8 @@ func TestJiraToMarkdown_Mixed(t *testing.T) {
 		"> line2",
 		"> **Title**",
 		"> panel line",
-		"![](img.png)",
-		"file.txt",
+		"📎 img.png",
+		"📎 file.txt",
 		"@bob",
 		"| A | B |",
 		"| 1 | 2 |",
@@ -108,3 +133,57 @@ func TestJiraToMarkdown_Mixed(t *testing.T) {
 		t.Errorf("mixed format\ngot:\n%q\nwant:\n%q", got, want)
 	}
 }
+
+// TestJiraToMarkdownGolden converts every testdata/wiki/*.jira file and
+// compares the result with the .md file next to it. Run with -update to
+// rewrite the .md files after an intended change.
+func TestJiraToMarkdownGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "wiki", "*.jira"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden inputs: %v", err)
+	}
+	for _, in := range files {
+		name := strings.TrimSuffix(filepath.Base(in), ".jira")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := JiraToMarkdown(string(src))
+			golden := strings.TrimSuffix(in, ".jira") + ".md"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s\ngot:\n%s\nwant:\n%s", name, got, want)
+			}
+		})
+	}
+}
+
+func FuzzJiraToMarkdown(f *testing.F) {
+	for _, seed := range []string{
+		"+bold+ *italic* _under_ -strike- {{mono}}",
+		"* a\n** b\n*# c\n# d",
+		"||h||h||\n|*a*|[b|http://c]|",
+		"{code:go}x{code}{quote}{panel:title=t}p{panel}{quote}",
+		"{color:red}x{color} !img.png! [~u] [^f] \\* \\\\",
+		"```a``` `b` https://example.com",
+		"*+_-{{[|]}}-_+*",
+		"h1. {code}",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		out := JiraToMarkdown(s)
+		if utf8.ValidString(s) && !utf8.ValidString(out) {
+			t.Fatalf("invalid UTF-8 output for %q", s)
+		}
+	})
+}
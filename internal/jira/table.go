@@ -0,0 +1,164 @@
+package jira
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TableStyle selects how tables in descriptions and comments are rendered.
+// Discord does not render Markdown tables.
+type TableStyle string
+
+const (
+	// TableCode renders a table as a column-aligned code block. Tables too
+	// wide for a Discord embed fall back to TableList.
+	TableCode TableStyle = "code"
+	// TableList renders each row as "Header: value" lines.
+	TableList TableStyle = "list"
+	// TableMarkdown renders rows as "| a | b |".
+	TableMarkdown TableStyle = "markdown"
+)
+
+// DefaultTableStyle is used for messages when no style is configured.
+const DefaultTableStyle = TableCode
+
+// Width limits of TableCode, in characters. A wider table does not fit an
+// embed on most screens.
+const (
+	tableMaxWidth = 60
+	tableCellMax  = 24
+)
+
+// ParseTableStyle validates a configured table style. An empty string
+// selects DefaultTableStyle.
+func ParseTableStyle(s string) (TableStyle, error) {
+	switch st := TableStyle(strings.ToLower(strings.TrimSpace(s))); st {
+	case "":
+		return DefaultTableStyle, nil
+	case TableCode, TableList, TableMarkdown:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown table style %q", s)
+}
+
+// tableCell holds a cell as Discord markdown and as plain text for code
+// blocks.
+type tableCell struct {
+	text, plain string
+}
+
+// renderTable renders rows in the given style. header tells whether the
+// first row holds column headers.
+func renderTable(rows [][]tableCell, header bool, style TableStyle) string {
+	switch style {
+	case TableMarkdown:
+		return markdownTable(rows)
+	case TableList:
+		return listTable(rows, header)
+	}
+	if s, ok := codeTable(rows, header); ok {
+		return s
+	}
+	return listTable(rows, header)
+}
+
+func markdownTable(rows [][]tableCell) string {
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, c := range row {
+			cells[j] = c.text
+		}
+		lines[i] = "| " + strings.Join(cells, " | ") + " |"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// codeTable pads cells to align columns, separating a header row with a
+// rule. It reports false when the table is wider than tableMaxWidth.
+func codeTable(rows [][]tableCell, header bool) (string, bool) {
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	if cols == 0 {
+		return "", false
+	}
+	cells := make([][]string, len(rows))
+	widths := make([]int, cols)
+	for i, row := range rows {
+		cells[i] = make([]string, cols)
+		for j, c := range row {
+			s := strings.Join(strings.Fields(c.plain), " ")
+			s = templateTruncate(tableCellMax, strings.ReplaceAll(s, "```", "'''"))
+			cells[i][j] = s
+			widths[j] = max(widths[j], len([]rune(s)))
+		}
+	}
+	total := 3 * (cols - 1)
+	for _, w := range widths {
+		total += w
+	}
+	if total > tableMaxWidth {
+		return "", false
+	}
+	pad := func(s string, w int) string {
+		return s + strings.Repeat(" ", w-len([]rune(s)))
+	}
+	var lines []string
+	for i, row := range cells {
+		padded := make([]string, cols)
+		for j, s := range row {
+			padded[j] = pad(s, widths[j])
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(padded, " | "), " "))
+		if i == 0 && header && len(cells) > 1 {
+			rule := make([]string, cols)
+			for j, w := range widths {
+				rule[j] = strings.Repeat("-", w)
+			}
+			lines = append(lines, strings.Join(rule, "-+-"))
+		}
+	}
+	return "```\n" + strings.Join(lines, "\n") + "\n```", true
+}
+
+// listTable renders each row of a table with headers as "**Header:** value"
+// lines, with a blank line between rows. Rows of a table without headers
+// become bullet points.
+func listTable(rows [][]tableCell, header bool) string {
+	if !header || len(rows) < 2 {
+		var lines []string
+		for _, row := range rows {
+			var cells []string
+			for _, c := range row {
+				if c.text != "" {
+					cells = append(cells, c.text)
+				}
+			}
+			if len(cells) > 0 {
+				lines = append(lines, "- "+strings.Join(cells, " · "))
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	keys := rows[0]
+	var groups []string
+	for _, row := range rows[1:] {
+		var lines []string
+		for j, c := range row {
+			if c.text == "" {
+				continue
+			}
+			if j < len(keys) && keys[j].plain != "" {
+				lines = append(lines, "**"+escapeMarkdown(keys[j].plain)+":** "+c.text)
+			} else {
+				lines = append(lines, c.text)
+			}
+		}
+		if len(lines) > 0 {
+			groups = append(groups, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(groups, "\n\n")
+}
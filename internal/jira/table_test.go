@@ -0,0 +1,90 @@
+package jira
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableStyles(t *testing.T) {
+	src := "||Name||Status||\n|*api*|{color:green}up{color}|\n|web \\| cdn|-down-|"
+	tests := []struct {
+		style TableStyle
+		want  string
+	}{
+		{TableMarkdown, "| Name | Status |\n| _api_ | up |\n| web \\| cdn | ~~down~~ |"},
+		{TableCode, "```\nName      | Status\n----------+-------\napi       | up\nweb | cdn | down\n```"},
+		{TableList, "**Name:** _api_\n**Status:** up\n\n**Name:** web \\| cdn\n**Status:** ~~down~~"},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.style), func(t *testing.T) {
+			if got := JiraToMarkdownStyle(src, tc.style); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTableWithoutHeader(t *testing.T) {
+	if got, want := JiraToMarkdownStyle("|1|2|\n|3|4|", TableCode), "```\n1 | 2\n3 | 4\n```"; got != want {
+		t.Errorf("code: got %q, want %q", got, want)
+	}
+	if got, want := JiraToMarkdownStyle("|1|2|\n|3||", TableList), "- 1 · 2\n- 3"; got != want {
+		t.Errorf("list: got %q, want %q", got, want)
+	}
+}
+
+func TestCodeTableLimits(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	got := JiraToMarkdownStyle("||A||B||\n|"+long+"|b|", TableCode)
+	want := "```\nA                        | B\n-------------------------+--\n" + strings.Repeat("x", 23) + "… | b\n```"
+	if got != want {
+		t.Errorf("truncated cell\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	wide := "||A||B||C||D||\n|" + strings.Repeat(long[:20]+"|", 4)
+	got = JiraToMarkdownStyle(wide, TableCode)
+	if strings.HasPrefix(got, "```") || !strings.HasPrefix(got, "**A:** "+long[:20]+"\n**B:**") {
+		t.Errorf("wide table should fall back to a list, got:\n%s", got)
+	}
+}
+
+func TestADFTableStyle(t *testing.T) {
+	w := loadWebhook(t, "adf_issue.json")
+	doc, _ := w.Issue.Fields.Description.ADF()
+	got := ADFToMarkdownStyle(doc, TableCode, nil)
+	if want := "```\nEnv  | State\n-----+------\nprod | down\n```"; !strings.Contains(got, want) {
+		t.Errorf("expected code table %q in:\n%s", want, got)
+	}
+}
+
+func TestParseTableStyle(t *testing.T) {
+	if s, err := ParseTableStyle(""); err != nil || s != DefaultTableStyle {
+		t.Errorf("empty: got %q, %v", s, err)
+	}
+	if s, err := ParseTableStyle(" List "); err != nil || s != TableList {
+		t.Errorf("list: got %q, %v", s, err)
+	}
+	if _, err := ParseTableStyle("grid"); err == nil {
+		t.Error("expected error for unknown style")
+	}
+}
+
+func TestRenderMessageTableStyle(t *testing.T) {
+	w := loadWebhook(t, "issue.json")
+	w.Issue.Fields.Description = "||A||B||\n|1|2|"
+	desc := func(opts RenderOptions) string {
+		msg := RenderMessage(w, "", opts)
+		for _, f := range msg.Embeds[0].Fields {
+			if f.Name == "Description" {
+				return f.Value
+			}
+		}
+		return ""
+	}
+	if got := desc(RenderOptions{}); !strings.HasPrefix(got, "```") {
+		t.Errorf("default style should be a code block, got %q", got)
+	}
+	if got := desc(RenderOptions{Tables: TableList}); got != "**A:** 1\n**B:** 2" {
+		t.Errorf("list style: got %q", got)
+	}
+}
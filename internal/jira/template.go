@@ -0,0 +1,382 @@
+package jira
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/utils"
+)
+
+// MessageTemplate describes a Discord message with Go text/template
+// strings. Every string is executed with a TemplateData. Empty title,
+// username and color fall back to the built-in layout's values, and fields
+// whose value renders empty are left out.
+type MessageTemplate struct {
+	Username    string `yaml:"username"`
+	Title       string `yaml:"title"`
+	URL         string `yaml:"url"`
+	Description string `yaml:"description"`
+	// Color renders an RGB value such as 0xFF6F3C, #FF6F3C or 16740156.
+	Color  string          `yaml:"color"`
+	Author *AuthorTemplate `yaml:"author"`
+	Footer *FooterTemplate `yaml:"footer"`
+	Fields []FieldTemplate `yaml:"fields"`
+}
+
+// AuthorTemplate renders an embed author.
+type AuthorTemplate struct {
+	Name    string `yaml:"name"`
+	URL     string `yaml:"url"`
+	IconURL string `yaml:"icon_url"`
+}
+
+// FooterTemplate renders an embed footer.
+type FooterTemplate struct {
+	Text    string `yaml:"text"`
+	IconURL string `yaml:"icon_url"`
+}
+
+// FieldTemplate renders an embed field.
+type FieldTemplate struct {
+	Name   string `yaml:"name"`
+	Value  string `yaml:"value"`
+	Inline bool   `yaml:"inline"`
+}
+
+// TemplateConfig is the YAML template configuration.
+type TemplateConfig struct {
+	Templates map[string]MessageTemplate `yaml:"templates"`
+	// Events selects a template per event type, e.g. comment_created.
+	Events map[Event]string `yaml:"events"`
+	// Default is used for events without a template of their own. When
+	// empty those events use the built-in layout.
+	Default string `yaml:"default"`
+}
+
+// TemplateData is passed to templates. The webhook's fields are available
+// directly, e.g. {{ .Issue.Key }} or {{ with .Comment }}{{ .Body }}{{ end }}.
+type TemplateData struct {
+	Webhook
+	Event Event
+	// Actor is the name of the user who caused the event.
+	Actor string
+	// URL links to the issue in Jira.
+	URL string
+	// Changes lists the changelog as rendered by the built-in layout.
+	Changes []string
+}
+
+// TemplateSet holds parsed message templates.
+type TemplateSet struct {
+	cfg       TemplateConfig
+	templates map[string]*compiledTemplate
+}
+
+type compiledTemplate struct {
+	username, title, url, description, color *template.Template
+	authorName, authorURL, authorIcon        *template.Template
+	footerText, footerIcon                   *template.Template
+	fields                                   []compiledField
+}
+
+type compiledField struct {
+	name, value *template.Template
+	inline      bool
+}
+
+// templateFuncs are available in every template.
+var templateFuncs = template.FuncMap{
+	// markdown converts Jira markup or ADF to Discord markdown with
+	// mentions. Templates are executed with the destination's table style
+	// and the user mapping of RenderOptions.
+	"markdown": markdownFunc(DefaultTableStyle, nil),
+	// jiraToMarkdown converts Jira markup without replacing mentions.
+	"jiraToMarkdown": JiraToMarkdown,
+	// mention returns a Discord mention for a Jira display name.
+	"mention":    (*utils.UserMapping)(nil).Mention,
+	"truncate":   templateTruncate,
+	"capitalize": Capitalize,
+	"join":       func(sep string, s []string) string { return strings.Join(s, sep) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"default": func(def, v string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// markdownFunc returns the markdown template function for a table style
+// and user mapping.
+func markdownFunc(tables TableStyle, users *utils.UserMapping) func(any) string {
+	return func(v any) string {
+		switch v := v.(type) {
+		case Text:
+			return formatText(v, tables, users)
+		case string:
+			return formatText(Text(v), tables, users)
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// templateTruncate shortens s to at most n runes, ending with "…" when cut.
+func templateTruncate(n int, s string) string {
+	return truncateString(s, n)
+}
+
+// LoadTemplateSet reads and validates the template configuration at path.
+func LoadTemplateSet(path string) (*TemplateSet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplates(b)
+}
+
+// ParseTemplates validates a YAML template configuration.
+func ParseTemplates(b []byte) (*TemplateSet, error) {
+	var cfg TemplateConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return NewTemplateSet(cfg)
+}
+
+// NewTemplateSet parses every template in cfg and checks that it renders
+// a sample event.
+func NewTemplateSet(cfg TemplateConfig) (*TemplateSet, error) {
+	ts := &TemplateSet{cfg: cfg, templates: make(map[string]*compiledTemplate)}
+	sample := sampleWebhook()
+	for name, mt := range cfg.Templates {
+		ct, err := compileTemplate(name, mt)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", name, err)
+		}
+		if _, err := ct.render(sample, "", RenderOptions{}.withDefaults()); err != nil {
+			return nil, fmt.Errorf("template %q: %w", name, err)
+		}
+		ts.templates[name] = ct
+	}
+	for ev, name := range cfg.Events {
+		if !ts.Has(name) {
+			return nil, fmt.Errorf("events: %s: unknown template %q", ev, name)
+		}
+	}
+	if cfg.Default != "" && !ts.Has(cfg.Default) {
+		return nil, fmt.Errorf("default: unknown template %q", cfg.Default)
+	}
+	return ts, nil
+}
+
+// Has reports whether the set defines the named template.
+func (ts *TemplateSet) Has(name string) bool {
+	_, ok := ts.templates[name]
+	return ok
+}
+
+// RenderOptions are the per-destination settings of RenderMessage.
+type RenderOptions struct {
+	// Template names the message template to use.
+	Template string
+	// Tables is the style of tables in descriptions and comments. Empty
+	// selects DefaultTableStyle.
+	Tables TableStyle
+	// Colors are the embed colors. The zero value selects DefaultColors.
+	Colors Colors
+	// Templates are the message templates. Nil renders every event with
+	// the built-in layout.
+	Templates *TemplateSet
+	// Users maps Jira users to the Discord users mentioned in their place.
+	// Nil mentions nobody.
+	Users *utils.UserMapping
+}
+
+// withDefaults fills in the options left unset.
+func (o RenderOptions) withDefaults() RenderOptions {
+	if o.Tables == "" {
+		o.Tables = DefaultTableStyle
+	}
+	if o.Colors == (Colors{}) {
+		o.Colors = DefaultColors
+	}
+	return o
+}
+
+// RenderMessage converts w into a Discord message using the template of
+// opts.Templates named in opts, the template selected for w's event, the
+// default template or the built-in layout, in that order. A template that fails to render is
+// logged and the built-in layout is used instead.
+func RenderMessage(w Webhook, baseURL string, opts RenderOptions) discord.WebhookMessage {
+	opts = opts.withDefaults()
+	ts := opts.Templates
+	if ts == nil {
+		return toDiscordMessage(w, baseURL, opts)
+	}
+	name := opts.Template
+	if name == "" {
+		name = ts.cfg.Events[w.Event()]
+	}
+	if name == "" {
+		name = ts.cfg.Default
+	}
+	ct, ok := ts.templates[name]
+	if !ok {
+		return toDiscordMessage(w, baseURL, opts)
+	}
+	msg, err := ct.render(w, baseURL, opts)
+	if err != nil {
+		zap.L().Error("failed to render message template, using the built-in layout",
+			zap.String("template", name), zap.String("issue", w.Issue.Key), zap.Error(err))
+		return toDiscordMessage(w, baseURL, opts)
+	}
+	return msg
+}
+
+func compileTemplate(name string, mt MessageTemplate) (*compiledTemplate, error) {
+	var err error
+	parse := func(part, text string) *template.Template {
+		if err != nil || text == "" {
+			return nil
+		}
+		var t *template.Template
+		t, err = template.New(name + "." + part).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+		return t
+	}
+	ct := &compiledTemplate{
+		username:    parse("username", mt.Username),
+		title:       parse("title", mt.Title),
+		url:         parse("url", mt.URL),
+		description: parse("description", mt.Description),
+		color:       parse("color", mt.Color),
+	}
+	if mt.Author != nil {
+		ct.authorName = parse("author.name", mt.Author.Name)
+		ct.authorURL = parse("author.url", mt.Author.URL)
+		ct.authorIcon = parse("author.icon_url", mt.Author.IconURL)
+	}
+	if mt.Footer != nil {
+		ct.footerText = parse("footer.text", mt.Footer.Text)
+		ct.footerIcon = parse("footer.icon_url", mt.Footer.IconURL)
+	}
+	for i, f := range mt.Fields {
+		part := "fields." + strconv.Itoa(i)
+		ct.fields = append(ct.fields, compiledField{
+			name:   parse(part+".name", f.Name),
+			value:  parse(part+".value", f.Value),
+			inline: f.Inline,
+		})
+	}
+	if len(ct.fields) > maxFields {
+		return nil, fmt.Errorf("more than %d fields", maxFields)
+	}
+	return ct, err
+}
+
+func (ct *compiledTemplate) render(w Webhook, baseURL string, opts RenderOptions) (discord.WebhookMessage, error) {
+	ev, tables := w.Event(), opts.Tables
+	data := TemplateData{
+		Webhook: w,
+		Event:   ev,
+		Actor:   w.Actor(),
+		URL:     issueURL(w, baseURL),
+		Changes: changeLines(w, opts.Users),
+	}
+	var err error
+	run := func(t *template.Template) string {
+		if err != nil || t == nil {
+			return ""
+		}
+		if tables != DefaultTableStyle || opts.Users != nil {
+			if t, err = t.Clone(); err != nil {
+				return ""
+			}
+			t.Funcs(template.FuncMap{
+				"markdown": markdownFunc(tables, opts.Users),
+				"mention":  opts.Users.Mention,
+			})
+		}
+		var b bytes.Buffer
+		if err = t.Execute(&b, data); err != nil {
+			return ""
+		}
+		return strings.TrimSpace(b.String())
+	}
+	exec := func(t *template.Template, max int) string {
+		return truncateString(run(t), max)
+	}
+	// Descriptions and field values are markdown and link to the issue
+	// when cut.
+	execMarkdown := func(t *template.Template, max int) string {
+		return discord.Truncate(run(t), max, data.URL)
+	}
+
+	embed := discord.Embed{
+		Title:       exec(ct.title, titleMax),
+		URL:         exec(ct.url, 2048),
+		Description: execMarkdown(ct.description, descMax),
+		Color:       eventColor(w, ev, opts.Colors),
+	}
+	if embed.Title == "" {
+		embed.Title = truncateString(fmt.Sprintf("%s: %s", w.Issue.Key, w.Issue.Fields.Summary), titleMax)
+	}
+	if ct.url == nil {
+		embed.URL = data.URL
+	}
+	if c := exec(ct.color, 32); c != "" {
+		base := 0
+		if strings.HasPrefix(c, "#") {
+			base = 16
+		}
+		// Discord rejects colors outside the RGB range, which would send
+		// every message of the template to the dead letters.
+		v, perr := strconv.ParseInt(strings.TrimPrefix(c, "#"), base, 32)
+		if perr != nil || v < 0 || v > 0xFFFFFF {
+			return discord.WebhookMessage{}, fmt.Errorf("color: invalid value %q", c)
+		}
+		embed.Color = int(v)
+	}
+	if name := exec(ct.authorName, authorNameMax); name != "" {
+		embed.Author = &discord.Author{Name: name, URL: exec(ct.authorURL, 2048), IconURL: exec(ct.authorIcon, 2048)}
+	}
+	if text := exec(ct.footerText, footerTextMax); text != "" {
+		embed.Footer = &discord.Footer{Text: text, IconURL: exec(ct.footerIcon, 2048)}
+	}
+	for _, f := range ct.fields {
+		name, value := exec(f.name, fieldNameMax), execMarkdown(f.value, fieldValueMax)
+		if name == "" || value == "" {
+			continue
+		}
+		embed.Fields = append(embed.Fields, discord.Field{Name: name, Value: value, Inline: f.inline})
+	}
+	username := exec(ct.username, 80)
+	if username == "" {
+		username = "Jira"
+	}
+	if err != nil {
+		return discord.WebhookMessage{}, err
+	}
+	return discord.WebhookMessage{Username: username, Embeds: []discord.Embed{embed}}, nil
+}
+
+// sampleWebhook is used to check templates at startup. Comment and
+// changelog are set so that misspelled fields below them are reported.
+func sampleWebhook() Webhook {
+	var w Webhook
+	w.WebhookEvent = "jira:issue_updated"
+	w.Issue.Key = "PRJ-1"
+	w.Issue.Fields.Summary = "Sample issue"
+	w.User = &User{DisplayName: "Sample User"}
+	w.Comment = &Comment{ID: "1", Body: "Sample comment", Author: User{DisplayName: "Sample User"}}
+	w.Changelog = &Changelog{Items: []ChangelogItem{{Field: "status", FromString: "Open", ToString: "Done"}}}
+	return w
+}
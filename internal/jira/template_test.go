@@ -0,0 +1,120 @@
+package jira
+
+import (
+	"strings"
+	"testing"
+
+	"jira-discord-webhook/internal/utils"
+)
+
+const testTemplates = `templates:
+  compact:
+    username: Tracker
+    title: "[{{ .Issue.Fields.Issuetype.Name | upper }}] {{ .Issue.Key }}"
+    description: "{{ with .Comment }}{{ .Body | markdown }}{{ else }}{{ .Issue.Fields.Summary }}{{ end }}"
+    color: "{{ if eq .Event \"comment_created\" }}#00FF00{{ end }}"
+    author:
+      name: "{{ .Actor | default \"Jira\" }}"
+    footer:
+      text: "{{ .Issue.Fields.Status.Name }}"
+    fields:
+      - name: Changes
+        value: '{{ join "\n" .Changes }}'
+      - name: Assignee
+        value: "{{ mention .Issue.Fields.Assignee.DisplayName }}"
+        inline: true
+  titleOnly:
+    title: "{{ truncate 8 .Issue.Fields.Summary }}"
+events:
+  comment_created: compact
+default: titleOnly
+`
+
+func TestRenderMessageTemplates(t *testing.T) {
+	ts, err := ParseTemplates([]byte(testTemplates))
+	if err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	w := loadWebhook(t, "comment.json")
+	w.WebhookEvent = "comment_created"
+	msg := RenderMessage(w, "https://example.com/browse", RenderOptions{Templates: ts})
+	e := msg.Embeds[0]
+	if msg.Username != "Tracker" || e.Title != "[TASK] PRJ-2" || e.Description != "looks good" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if e.URL != "https://example.com/browse/PRJ-2" || e.Color != 0x00FF00 {
+		t.Fatalf("unexpected url or color: %s %x", e.URL, e.Color)
+	}
+	if e.Author == nil || e.Author.Name != "Alice" || e.Footer == nil || e.Footer.Text != "Open" {
+		t.Fatalf("unexpected author or footer: %+v %+v", e.Author, e.Footer)
+	}
+	if len(e.Fields) != 1 || e.Fields[0].Name != "Assignee" || e.Fields[0].Value != "Bob" || !e.Fields[0].Inline {
+		t.Fatalf("empty fields should be skipped: %+v", e.Fields)
+	}
+
+	// Events without a template of their own use the default template.
+	issue := loadWebhook(t, "issue.json")
+	msg = RenderMessage(issue, "", RenderOptions{Templates: ts})
+	if msg.Username != "Jira" || msg.Embeds[0].Title != "Test is…" || msg.Embeds[0].Color != issueColor {
+		t.Fatalf("unexpected default message: %+v", msg)
+	}
+
+	// A template named by the route takes precedence.
+	msg = RenderMessage(issue, "", RenderOptions{Template: "compact", Templates: ts})
+	if msg.Embeds[0].Title != "[TASK] PRJ-1" {
+		t.Fatalf("unexpected title: %s", msg.Embeds[0].Title)
+	}
+
+	// Templates mention the users of the mapping passed in.
+	users, err := utils.ParseUserMapping([]byte("jira_to_discord:\n  - displayName: Bob\n    discordId: \"42\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = RenderMessage(w, "", RenderOptions{Templates: ts, Users: users})
+	if f := msg.Embeds[0].Fields; len(f) != 1 || f[0].Value != "<@42>" {
+		t.Fatalf("unexpected mention: %+v", f)
+	}
+}
+
+func TestRenderMessageBuiltIn(t *testing.T) {
+	w := loadWebhook(t, "issue.json")
+	got := RenderMessage(w, "", RenderOptions{})
+	want := ToDiscordMessage(w, "")
+	if got.Embeds[0].Title != want.Embeds[0].Title || len(got.Embeds[0].Fields) != len(want.Embeds[0].Fields) {
+		t.Fatal("without templates the built-in layout should be used")
+	}
+}
+
+func TestRenderMessageFallback(t *testing.T) {
+	ts, err := ParseTemplates([]byte("templates:\n  bad:\n    color: \"{{ .Issue.Fields.Priority.Name }}\"\n"))
+	if err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	w := loadWebhook(t, "issue.json")
+	msg := RenderMessage(w, "", RenderOptions{Template: "bad", Templates: ts})
+	if len(msg.Embeds[0].Fields) == 0 || msg.Embeds[0].Title != "PRJ-1: Test issue" {
+		t.Fatalf("expected the built-in layout, got %+v", msg)
+	}
+}
+
+func TestParseTemplatesInvalid(t *testing.T) {
+	tests := map[string]string{
+		"syntax":          "templates:\n  a:\n    title: \"{{ .Issue.Key \"\n",
+		"unknownFunction": "templates:\n  a:\n    title: \"{{ shout .Issue.Key }}\"\n",
+		"unknownField":    "templates:\n  a:\n    title: \"{{ .Issue.Name }}\"\n",
+		"unknownComment":  "templates:\n  a:\n    title: \"{{ .Comment.Text }}\"\n",
+		"unknownEvent":    "templates:\n  a:\n    title: x\nevents:\n  issue_created: b\n",
+		"unknownDefault":  "default: b\n",
+		"tooManyFields":   "templates:\n  a:\n    fields:\n" + strings.Repeat("      - {name: a, value: b}\n", 26),
+		"negativeColor":   "templates:\n  a:\n    color: \"-1\"\n",
+		"colorTooLarge":   "templates:\n  a:\n    color: \"0x7FFFFFFF\"\n",
+		"hexColorTooLong": "templates:\n  a:\n    color: \"#1000000\"\n",
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseTemplates([]byte(cfg)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package jira
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 // JiraIssue represents a Jira issue payload
 // from webhook events.
 type Issue struct {
 	Key    string `json:"key"`
 	Fields struct {
 		Summary     string `json:"summary"`
-		Description string `json:"description"`
+		Description Text   `json:"description"`
 		Priority    struct {
 			Name string `json:"name"`
 		} `json:"priority"`
@@ -14,20 +19,68 @@ type Issue struct {
 			DisplayName string `json:"displayName"`
 		} `json:"assignee"`
 		Issuetype struct {
-			Name string `json:"name"`
+			Name    string `json:"name"`
+			IconURL string `json:"iconUrl,omitempty"`
 		} `json:"issuetype"`
 		Status struct {
 			Name string `json:"name"`
 		} `json:"status"`
+		Project struct {
+			Key        string            `json:"key"`
+			Name       string            `json:"name"`
+			AvatarURLs map[string]string `json:"avatarUrls,omitempty"`
+		} `json:"project"`
+		Labels     []string `json:"labels"`
+		Components []struct {
+			Name string `json:"name"`
+		} `json:"components"`
+		Attachment []Attachment `json:"attachment,omitempty"`
 	} `json:"fields"`
 }
 
+// Attachment is a file attached to an issue.
+type Attachment struct {
+	ID       string `json:"id,omitempty"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	// Content is the download URL; it requires Jira credentials.
+	Content string `json:"content"`
+}
+
+// User is a Jira user as it appears in webhook payloads.
+type User struct {
+	AccountID   string            `json:"accountId,omitempty"`
+	DisplayName string            `json:"displayName"`
+	AvatarURLs  map[string]string `json:"avatarUrls,omitempty"`
+}
+
+// Avatar returns the URL of the user's 48x48 avatar, or of another size
+// when that one is missing.
+func (u User) Avatar() string {
+	return avatar(u.AvatarURLs)
+}
+
+// avatar picks the 48x48 URL from Jira's avatarUrls, falling back to the
+// largest other size.
+func avatar(urls map[string]string) string {
+	if u := urls["48x48"]; u != "" {
+		return u
+	}
+	for _, size := range []string{"32x32", "24x24", "16x16"} {
+		if u := urls[size]; u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
 // Comment is a Jira issue comment.
 type Comment struct {
-	Body   string `json:"body"`
-	Author struct {
-		DisplayName string `json:"displayName"`
-	} `json:"author"`
+	ID           string `json:"id,omitempty"`
+	Body         Text   `json:"body"`
+	Author       User   `json:"author"`
+	UpdateAuthor *User  `json:"updateAuthor,omitempty"`
 }
 
 // ChangelogItem represents a single change in an update event.
@@ -39,12 +92,74 @@ type ChangelogItem struct {
 
 // Changelog groups a list of changed fields.
 type Changelog struct {
+	ID    string          `json:"id,omitempty"`
 	Items []ChangelogItem `json:"items"`
 }
 
 // Webhook is the top level structure sent by Jira webhooks.
 type Webhook struct {
+	// Timestamp is the event time in milliseconds since the Unix epoch.
+	Timestamp          int64  `json:"timestamp,omitempty"`
+	WebhookEvent       string `json:"webhookEvent,omitempty"`
+	IssueEventTypeName string `json:"issue_event_type_name,omitempty"`
+	// User is the actor that triggered the event.
+	User      *User      `json:"user,omitempty"`
 	Issue     Issue      `json:"issue"`
 	Comment   *Comment   `json:"comment,omitempty"`
 	Changelog *Changelog `json:"changelog,omitempty"`
 }
+
+// Text is a rich-text value such as an issue description or comment body.
+// Jira Server and REST v2 send wiki markup strings, while Jira Cloud REST v3
+// sends Atlassian Document Format objects. An ADF value is kept as its JSON
+// so that it can be rendered and re-encoded unchanged.
+type Text string
+
+// UnmarshalJSON accepts a string, an ADF object or null.
+func (t *Text) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*t = ""
+		return nil
+	case len(b) > 0 && b[0] == '{':
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b); err != nil {
+			return err
+		}
+		*t = Text(buf.String())
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*t = Text(s)
+	return nil
+}
+
+// MarshalJSON encodes ADF values as objects and anything else as a string.
+func (t Text) MarshalJSON() ([]byte, error) {
+	if _, ok := t.ADF(); ok {
+		return []byte(t), nil
+	}
+	return json.Marshal(string(t))
+}
+
+// ADF returns the decoded document when t holds an ADF object.
+func (t Text) ADF() (*ADFNode, bool) {
+	if len(t) == 0 || t[0] != '{' {
+		return nil, false
+	}
+	doc, err := ParseADF([]byte(t))
+	if err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// Markdown converts t to Discord markdown, whether it holds wiki markup or
+// an ADF document. Jira users are not replaced with Discord mentions.
+func (t Text) Markdown() string {
+	return formatText(t, DefaultTableStyle, nil)
+}
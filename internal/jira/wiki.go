@@ -0,0 +1,680 @@
+package jira
+
+import (
+	"strings"
+	"unicode"
+)
+
+// This file parses Jira wiki markup into a small syntax tree that
+// jira2md.go renders as Discord markdown. Parsing happens in three steps:
+// splitBlocks separates the {code}, {noformat}, {quote} and {panel} macros
+// and Markdown code fences from plain text, parseLines turns the plain text
+// into headings, lists, tables and paragraphs, and parseInline tokenizes
+// and parses the text of each line.
+
+type wikiKind int
+
+const (
+	// Block nodes.
+	wikiDoc        wikiKind = iota
+	wikiRaw                 // text passed through unchanged, e.g. a ``` fence
+	wikiCodeBlock           // text: content, attr: language
+	wikiQuote               // children: blocks
+	wikiPanel               // attr: title, children: blocks
+	wikiLine                // children: inlines
+	wikiHeading             // level, children: inlines
+	wikiBlockquote          // children: inlines (bq.)
+	wikiRule
+	wikiList     // attr: "*" or "#", children: list items
+	wikiListItem // children[0]: wikiLine, further children: nested lists
+	wikiTable    // children: rows
+	wikiRow      // children: cells
+	wikiCell     // header, children: inlines
+
+	// Inline nodes.
+	wikiText      // text; attr: the character of an escape such as \*
+	wikiEmphasis  // attr: the Jira marker (* _ + -), children: inlines
+	wikiMonospace // text
+	wikiCodeSpan  // text, including the backticks
+	wikiLink      // attr: url, children: inlines
+	wikiMention   // text: user
+	wikiAttach    // text: file name
+	wikiImage     // text: file name or url
+	wikiURL       // text
+	wikiBreak
+)
+
+type wikiNode struct {
+	kind     wikiKind
+	text     string
+	attr     string
+	level    int
+	header   bool
+	children []*wikiNode
+}
+
+// parseWiki parses Jira wiki markup.
+func parseWiki(s string) *wikiNode {
+	return &wikiNode{kind: wikiDoc, children: splitBlocks(s, true)}
+}
+
+// splitBlocks separates block macros from the text between them. The text
+// keeps its own line breaks so that macros in the middle of a line stay
+// there. atLineStart tells whether s begins at the start of a line.
+func splitBlocks(s string, atLineStart bool) []*wikiNode {
+	var nodes []*wikiNode
+	for s != "" {
+		start, end, node := nextBlockMacro(s)
+		if node == nil {
+			nodes = append(nodes, parseLines(s, atLineStart)...)
+			break
+		}
+		if start > 0 {
+			nodes = append(nodes, parseLines(s[:start], atLineStart)...)
+			atLineStart = strings.HasSuffix(s[:start], "\n")
+		}
+		nodes = append(nodes, node)
+		s = s[end:]
+		atLineStart = false
+	}
+	return nodes
+}
+
+// nextBlockMacro finds the first complete block macro or code fence in s.
+func nextBlockMacro(s string) (start, end int, node *wikiNode) {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "```"):
+			if j := strings.Index(s[i+3:], "```"); j >= 0 {
+				end := i + 3 + j + 3
+				return i, end, &wikiNode{kind: wikiRaw, text: s[i:end]}
+			}
+		case s[i] == '{':
+			name, params, tagEnd, ok := macroTag(s[i:])
+			if !ok {
+				continue
+			}
+			closeTag := "{" + name + "}"
+			body := s[i+tagEnd:]
+			j := indexClose(body, closeTag, name == "quote" || name == "panel")
+			if j < 0 {
+				continue
+			}
+			end := i + tagEnd + j + len(closeTag)
+			content := body[:j]
+			switch name {
+			case "code":
+				return i, end, &wikiNode{kind: wikiCodeBlock, text: strings.TrimSpace(content), attr: codeLanguage(params)}
+			case "noformat":
+				return i, end, &wikiNode{kind: wikiCodeBlock, text: strings.TrimSpace(content)}
+			case "quote":
+				return i, end, &wikiNode{kind: wikiQuote, children: splitBlocks(strings.TrimSpace(content), true)}
+			case "panel":
+				return i, end, &wikiNode{kind: wikiPanel, attr: macroParam(params, "title"), children: splitBlocks(strings.TrimSpace(content), true)}
+			}
+		}
+	}
+	return 0, 0, nil
+}
+
+// macroTag parses an opening block macro tag such as {code:go} or
+// {panel:title=Notes|borderStyle=dashed} at the start of s.
+func macroTag(s string) (name, params string, end int, ok bool) {
+	closeAt := strings.IndexByte(s, '}')
+	if closeAt < 0 {
+		return "", "", 0, false
+	}
+	tag := s[1:closeAt]
+	name, params, _ = strings.Cut(tag, ":")
+	switch name {
+	case "code", "noformat", "quote", "panel":
+		return name, params, closeAt + 1, true
+	}
+	return "", "", 0, false
+}
+
+// indexClose finds closeTag in s. When the macro can contain other macros,
+// code blocks inside it are skipped.
+func indexClose(s, closeTag string, nested bool) int {
+	if !nested {
+		return strings.Index(s, closeTag)
+	}
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], closeTag) {
+			return i
+		}
+		if s[i] == '{' {
+			if name, _, tagEnd, ok := macroTag(s[i:]); ok && (name == "code" || name == "noformat") {
+				if j := strings.Index(s[i+tagEnd:], "{"+name+"}"); j >= 0 {
+					i += tagEnd + j + len(name) + 2
+					continue
+				}
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// codeLanguage returns the language of {code:go} or {code:language=go}.
+func codeLanguage(params string) string {
+	for _, p := range strings.Split(params, "|") {
+		if !strings.Contains(p, "=") {
+			return strings.TrimSpace(p)
+		}
+	}
+	return macroParam(params, "language")
+}
+
+func macroParam(params, key string) string {
+	for _, p := range strings.Split(params, "|") {
+		if k, v, ok := strings.Cut(p, "="); ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// parseLines parses text without block macros line by line.
+func parseLines(s string, atLineStart bool) []*wikiNode {
+	lines := strings.Split(s, "\n")
+	var nodes []*wikiNode
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if i == 0 && !atLineStart {
+			nodes = append(nodes, &wikiNode{kind: wikiLine, children: parseInline(line)})
+			continue
+		}
+		if _, _, ok := listMarker(line); ok {
+			j := i
+			for j < len(lines) {
+				if _, _, ok := listMarker(lines[j]); !ok {
+					break
+				}
+				j++
+			}
+			nodes = append(nodes, parseList(lines[i:j])...)
+			i = j - 1
+			continue
+		}
+		if isTableRow(line) {
+			j := i
+			for j < len(lines) && isTableRow(lines[j]) {
+				j++
+			}
+			table := &wikiNode{kind: wikiTable}
+			for _, row := range lines[i:j] {
+				table.children = append(table.children, parseRow(row))
+			}
+			nodes = append(nodes, table)
+			i = j - 1
+			continue
+		}
+		nodes = append(nodes, parseLine(line))
+	}
+	return nodes
+}
+
+// parseLine parses a line that is not part of a list or table.
+func parseLine(line string) *wikiNode {
+	if level, text, ok := headingLine(line); ok {
+		return &wikiNode{kind: wikiHeading, level: level, children: parseInline(text)}
+	}
+	if rest, ok := strings.CutPrefix(line, "bq."); ok && rest != "" && unicode.IsSpace(rune(rest[0])) {
+		return &wikiNode{kind: wikiBlockquote, children: parseInline(strings.TrimLeft(rest, " \t"))}
+	}
+	if trimmed := strings.TrimRight(line, " \t\r"); len(trimmed) >= 4 && strings.Trim(trimmed, "-") == "" {
+		return &wikiNode{kind: wikiRule}
+	}
+	return &wikiNode{kind: wikiLine, children: parseInline(line)}
+}
+
+// headingLine recognises "h1. Title" through "h6. Title".
+func headingLine(line string) (int, string, bool) {
+	if len(line) < 5 || line[0] != 'h' || line[1] < '1' || line[1] > '6' || line[2] != '.' || !unicode.IsSpace(rune(line[3])) {
+		return 0, "", false
+	}
+	text := strings.TrimLeft(line[3:], " \t")
+	if text == "" {
+		return 0, "", false
+	}
+	return int(line[1] - '0'), text, true
+}
+
+// listMarker recognises list lines such as "* item", "## step" or
+// "*# nested step" and returns the marker and the item text.
+func listMarker(line string) (marker, text string, ok bool) {
+	s := strings.TrimLeft(line, " \t")
+	n := 0
+	for n < len(s) && (s[n] == '*' || s[n] == '#') {
+		n++
+	}
+	if n == 0 || n == len(s) || (s[n] != ' ' && s[n] != '\t') {
+		return "", "", false
+	}
+	return s[:n], strings.TrimLeft(s[n:], " \t"), true
+}
+
+// parseList builds nested lists from consecutive list lines. The last
+// character of a marker selects the list type and its length the depth.
+func parseList(lines []string) []*wikiNode {
+	var roots []*wikiNode
+	// stack[d] is the open list at depth d+1.
+	var stack []*wikiNode
+	for _, line := range lines {
+		marker, text, _ := listMarker(line)
+		depth := len(marker)
+		kind := marker[depth-1:]
+		if depth > len(stack)+1 {
+			depth = len(stack) + 1
+		}
+		stack = stack[:min(len(stack), depth)]
+		if len(stack) == depth && stack[depth-1].attr != kind {
+			stack = stack[:depth-1]
+		}
+		if len(stack) < depth {
+			list := &wikiNode{kind: wikiList, attr: kind}
+			if depth == 1 {
+				roots = append(roots, list)
+			} else {
+				parent := stack[depth-2]
+				if len(parent.children) == 0 {
+					parent.children = append(parent.children, &wikiNode{kind: wikiListItem, children: []*wikiNode{{kind: wikiLine}}})
+				}
+				item := parent.children[len(parent.children)-1]
+				item.children = append(item.children, list)
+			}
+			stack = append(stack, list)
+		}
+		list := stack[depth-1]
+		list.children = append(list.children, &wikiNode{kind: wikiListItem, children: []*wikiNode{
+			{kind: wikiLine, children: parseInline(text)},
+		}})
+	}
+	return roots
+}
+
+func isTableRow(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), "|")
+}
+
+// parseRow splits a table row into cells. "||" separates header cells and
+// "|" normal cells; separators inside links, macros and code are ignored.
+func parseRow(line string) *wikiNode {
+	s := strings.TrimSpace(line)
+	row := &wikiNode{kind: wikiRow}
+	var cell strings.Builder
+	header := false
+	started := false
+	flush := func() {
+		if started {
+			row.children = append(row.children, &wikiNode{kind: wikiCell, header: header, children: parseInline(strings.TrimSpace(cell.String()))})
+		}
+		cell.Reset()
+	}
+	depthBracket, depthBrace := 0, 0
+	inCode := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			cell.WriteByte(c)
+			cell.WriteByte(s[i+1])
+			i++
+			continue
+		case c == '`':
+			inCode = !inCode
+		case inCode:
+		case c == '[':
+			depthBracket++
+		case c == ']' && depthBracket > 0:
+			depthBracket--
+		case c == '{':
+			depthBrace++
+		case c == '}' && depthBrace > 0:
+			depthBrace--
+		case c == '|' && depthBracket == 0 && depthBrace == 0:
+			flush()
+			started = true
+			header = i+1 < len(s) && s[i+1] == '|'
+			if header {
+				i++
+			}
+			continue
+		}
+		cell.WriteByte(c)
+	}
+	if strings.TrimSpace(cell.String()) != "" {
+		flush()
+	}
+	return row
+}
+
+// Inline tokens.
+type inlineKind int
+
+const (
+	tokText inlineKind = iota
+	tokEscape
+	tokMark
+	tokMonospace
+	tokCodeSpan
+	tokLink
+	tokImage
+	tokURL
+	tokColorOpen
+	tokColorClose
+	tokBreak
+)
+
+type inlineToken struct {
+	kind     inlineKind
+	text     string
+	canOpen  bool
+	canClose bool
+}
+
+// emphasisMarks are the Jira markers that format text: *strong*,
+// _emphasis_, +inserted+ and -deleted-.
+const emphasisMarks = "*_+-"
+
+// tokenizeInline splits a line of wiki markup into tokens.
+func tokenizeInline(s string) []inlineToken {
+	rs := []rune(s)
+	var toks []inlineToken
+	var text strings.Builder
+	emit := func(t inlineToken) {
+		if text.Len() > 0 {
+			toks = append(toks, inlineToken{kind: tokText, text: text.String()})
+			text.Reset()
+		}
+		toks = append(toks, t)
+	}
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && i+1 < len(rs):
+			if rs[i+1] == '\\' {
+				emit(inlineToken{kind: tokBreak})
+			} else {
+				emit(inlineToken{kind: tokEscape, text: string(rs[i+1])})
+			}
+			i++
+			continue
+		case r == '`':
+			n := runLength(rs, i, '`')
+			if j := indexRun(rs, i+n, '`', n); j >= 0 {
+				emit(inlineToken{kind: tokCodeSpan, text: string(rs[i : j+n])})
+				i = j + n - 1
+				continue
+			}
+			text.WriteString(string(rs[i : i+n]))
+			i += n - 1
+			continue
+		case r == '{':
+			if j := indexRunes(rs, i, "{{"); j == i {
+				if k := indexRunes(rs, i+2, "}}"); k >= 0 {
+					emit(inlineToken{kind: tokMonospace, text: string(rs[i+2 : k])})
+					i = k + 1
+					continue
+				}
+			}
+			if hasPrefixRunes(rs[i:], "{color}") {
+				emit(inlineToken{kind: tokColorClose, text: "{color}"})
+				i += len("{color}") - 1
+				continue
+			}
+			if hasPrefixRunes(rs[i:], "{color:") {
+				if k := indexRunes(rs, i, "}"); k >= 0 {
+					emit(inlineToken{kind: tokColorOpen, text: string(rs[i : k+1])})
+					i = k
+					continue
+				}
+			}
+		case r == '[':
+			if k := indexRunes(rs, i+1, "]"); k > i+1 {
+				emit(inlineToken{kind: tokLink, text: string(rs[i+1 : k])})
+				i = k
+				continue
+			}
+		case r == '!':
+			if k := indexRunes(rs, i+1, "!"); k > i+1 && isImageTarget(string(rs[i+1:k])) {
+				emit(inlineToken{kind: tokImage, text: string(rs[i+1 : k])})
+				i = k
+				continue
+			}
+		case strings.ContainsRune(emphasisMarks, r):
+			prev, next := runeAt(rs, i-1), runeAt(rs, i+1)
+			t := inlineToken{
+				kind:     tokMark,
+				text:     string(r),
+				canOpen:  !isWordRune(prev) && next != 0 && !unicode.IsSpace(next),
+				canClose: prev != 0 && !unicode.IsSpace(prev) && !isWordRune(next),
+			}
+			if t.canOpen || t.canClose {
+				emit(t)
+				continue
+			}
+		case r == 'h' || r == 'f':
+			if n := urlLength(rs, i); n > 0 {
+				emit(inlineToken{kind: tokURL, text: string(rs[i : i+n])})
+				i += n - 1
+				continue
+			}
+		}
+		text.WriteRune(r)
+	}
+	if text.Len() > 0 {
+		toks = append(toks, inlineToken{kind: tokText, text: text.String()})
+	}
+	return toks
+}
+
+// parseInline parses a line of wiki markup into inline nodes.
+func parseInline(s string) []*wikiNode {
+	return parseTokens(tokenizeInline(s))
+}
+
+func parseTokens(toks []inlineToken) []*wikiNode {
+	var nodes []*wikiNode
+	text := func(s string) {
+		if n := len(nodes); n > 0 && nodes[n-1].kind == wikiText && nodes[n-1].attr == "" {
+			nodes[n-1].text += s
+			return
+		}
+		nodes = append(nodes, &wikiNode{kind: wikiText, text: s})
+	}
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch t.kind {
+		case tokText:
+			text(t.text)
+		case tokEscape:
+			nodes = append(nodes, &wikiNode{kind: wikiText, text: escapeMarkdown(t.text), attr: t.text})
+		case tokBreak:
+			nodes = append(nodes, &wikiNode{kind: wikiBreak})
+		case tokMonospace:
+			nodes = append(nodes, &wikiNode{kind: wikiMonospace, text: t.text})
+		case tokCodeSpan:
+			nodes = append(nodes, &wikiNode{kind: wikiCodeSpan, text: t.text})
+		case tokURL:
+			nodes = append(nodes, &wikiNode{kind: wikiURL, text: t.text})
+		case tokImage:
+			target, _, _ := strings.Cut(t.text, "|")
+			nodes = append(nodes, &wikiNode{kind: wikiImage, text: target})
+		case tokLink:
+			nodes = append(nodes, linkNode(t.text))
+		case tokMark:
+			if t.canOpen {
+				if j := closingMark(toks, i); j >= 0 {
+					nodes = append(nodes, &wikiNode{kind: wikiEmphasis, attr: t.text, children: parseTokens(toks[i+1 : j])})
+					i = j
+					continue
+				}
+			}
+			text(t.text)
+		case tokColorOpen:
+			if j := closingColor(toks, i); j >= 0 {
+				nodes = append(nodes, parseTokens(toks[i+1:j])...)
+				i = j
+				continue
+			}
+			text(t.text)
+		case tokColorClose:
+			text(t.text)
+		}
+	}
+	return nodes
+}
+
+// closingMark finds the marker closing toks[open]; the marked text must
+// not be empty.
+func closingMark(toks []inlineToken, open int) int {
+	for j := open + 2; j < len(toks); j++ {
+		if toks[j].kind == tokMark && toks[j].text == toks[open].text && toks[j].canClose {
+			return j
+		}
+	}
+	return -1
+}
+
+func closingColor(toks []inlineToken, open int) int {
+	for j := open + 1; j < len(toks); j++ {
+		if toks[j].kind == tokColorClose {
+			return j
+		}
+	}
+	return -1
+}
+
+// linkNode parses the inside of [...]: a mention, attachment, link or
+// plain bracketed text.
+func linkNode(inner string) *wikiNode {
+	switch {
+	case strings.HasPrefix(inner, "~"):
+		return &wikiNode{kind: wikiMention, text: inner[1:]}
+	case strings.HasPrefix(inner, "^"):
+		return &wikiNode{kind: wikiAttach, text: inner[1:]}
+	}
+	if i := strings.LastIndexByte(inner, '|'); i > 0 {
+		url := strings.TrimSpace(inner[i+1:])
+		if isURL(inner[:i]) {
+			return &wikiNode{kind: wikiLink, attr: url, children: []*wikiNode{{kind: wikiText, text: inner[:i]}}}
+		}
+		return &wikiNode{kind: wikiLink, attr: url, children: parseInline(inner[:i])}
+	}
+	if isURL(inner) {
+		return &wikiNode{kind: wikiLink, attr: inner, children: []*wikiNode{{kind: wikiText, text: inner}}}
+	}
+	return &wikiNode{kind: wikiText, text: "[" + inner + "]"}
+}
+
+func isURL(s string) bool {
+	for _, p := range []string{"http://", "https://", "ftp://", "mailto:"} {
+		if strings.HasPrefix(s, p) && len(s) > len(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isImageTarget tells an image reference such as !screenshot.png! or
+// !http://example.com/a.png|thumbnail! from exclamation marks in prose.
+func isImageTarget(s string) bool {
+	target, _, _ := strings.Cut(s, "|")
+	if target == "" || strings.ContainsAny(target, "\n!") {
+		return false
+	}
+	first, last := []rune(target)[0], []rune(target)[len([]rune(target))-1]
+	if unicode.IsSpace(first) || unicode.IsSpace(last) {
+		return false
+	}
+	return strings.Contains(target, "://") || strings.Contains(target, ".")
+}
+
+// urlChars are the characters bare URLs may contain.
+const urlChars = "-._~:/?#[]@!$&'()*+,;=%"
+
+// urlLength returns the length of the bare URL starting at rs[i], or 0.
+// URLs must start a word and trailing punctuation is not part of them.
+func urlLength(rs []rune, i int) int {
+	if prev := runeAt(rs, i-1); prev != 0 && !unicode.IsSpace(prev) && !strings.ContainsRune(">([{", prev) {
+		return 0
+	}
+	var scheme string
+	for _, p := range []string{"http://", "https://", "ftp://"} {
+		if hasPrefixRunes(rs[i:], p) {
+			scheme = p
+			break
+		}
+	}
+	if scheme == "" {
+		return 0
+	}
+	n := len(scheme)
+	for i+n < len(rs) && (isWordRune(rs[i+n]) || strings.ContainsRune(urlChars, rs[i+n])) {
+		n++
+	}
+	for n > len(scheme) && strings.ContainsRune(".,;:!?)]}'", rs[i+n-1]) {
+		n--
+	}
+	if n == len(scheme) {
+		return 0
+	}
+	return n
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func runeAt(rs []rune, i int) rune {
+	if i < 0 || i >= len(rs) {
+		return 0
+	}
+	return rs[i]
+}
+
+func runLength(rs []rune, i int, r rune) int {
+	n := 0
+	for i+n < len(rs) && rs[i+n] == r {
+		n++
+	}
+	return n
+}
+
+// indexRun finds the next run of exactly n copies of r at or after from.
+func indexRun(rs []rune, from int, r rune, n int) int {
+	for i := from; i < len(rs); {
+		if rs[i] != r {
+			i++
+			continue
+		}
+		m := runLength(rs, i, r)
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+func indexRunes(rs []rune, from int, sub string) int {
+	for i := from; i < len(rs); i++ {
+		if hasPrefixRunes(rs[i:], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasPrefixRunes(rs []rune, prefix string) bool {
+	i := 0
+	for _, p := range prefix {
+		if i >= len(rs) || rs[i] != p {
+			return false
+		}
+		i++
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+// Package metrics defines the Prometheus metrics of the service.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jira_discord"
+
+// Webhook ingestion.
+var (
+	EventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "Jira webhook events received, by event type and project.",
+	}, []string{"event", "project"})
+	EventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Jira webhook events not forwarded, by reason (filtered, duplicate, unrouted).",
+	}, []string{"reason"})
+	ParseFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_parse_failures_total",
+		Help:      "Jira webhook requests whose body could not be decoded.",
+	})
+	RenderDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_duration_seconds",
+		Help:      "Time spent rendering a Jira event into a Discord message.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+	})
+)
+
+// Discord requests.
+var (
+	DiscordRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_requests_total",
+		Help:      "Requests to Discord webhooks, by method and status code (\"error\" for network errors).",
+	}, []string{"method", "status"})
+	DiscordRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "discord_request_duration_seconds",
+		Help:      "Latency of requests to Discord webhooks, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	DiscordRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_retries_total",
+		Help:      "Requests to Discord retried after a network error, 429 or 5xx response.",
+	})
+	RateLimitWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "discord_rate_limit_wait_seconds",
+		Help:      "Time spent waiting for Discord rate limits before a request.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+)
+
+// Delivery of notifications.
+var (
+	Deliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deliveries_total",
+		Help:      "Notification delivery attempts, by destination and result (delivered, retry, failed, dead_letter).",
+	}, []string{"destination", "result"})
+	DeliveryLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_latency_seconds",
+		Help:      "Time from receiving a Jira event to delivering it to Discord, including retries.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	})
+	LastDelivery = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_delivery_timestamp_seconds",
+		Help:      "Unix time of the last notification delivered to Discord.",
+	})
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Notifications queued, in flight or waiting to retry.",
+	})
+)
+
+// Delivered records a notification for destination, received at
+// createdAt, as delivered.
+func Delivered(destination string, createdAt time.Time) {
+	Deliveries.WithLabelValues(destination, "delivered").Inc()
+	if !createdAt.IsZero() {
+		DeliveryLatency.Observe(time.Since(createdAt).Seconds())
+	}
+	LastDelivery.SetToCurrentTime()
+}
+
+// Registry holds the metrics above and the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsReceived, EventsDropped, ParseFailures, RenderDuration,
+		DiscordRequests, DiscordRequestDuration, DiscordRetries, RateLimitWait,
+		Deliveries, DeliveryLatency, LastDelivery, QueueDepth,
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
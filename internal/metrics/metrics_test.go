@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	EventsReceived.WithLabelValues("jira:issue_created", "PRJ").Inc()
+	Delivered("general", time.Now().Add(-time.Second))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`jira_discord_events_received_total{event="jira:issue_created",project="PRJ"} 1`,
+		`jira_discord_deliveries_total{destination="general",result="delivered"} 1`,
+		"jira_discord_delivery_latency_seconds_count 1",
+		"jira_discord_last_delivery_timestamp_seconds",
+		"jira_discord_queue_depth",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrNotFound is returned when a dead letter does not exist.
+var ErrNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a job that could not be delivered, kept for inspection and
+// replay.
+type DeadLetter struct {
+	Job
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// DeadLetterStore keeps dead letters as one JSON file each in a directory.
+type DeadLetterStore struct {
+	dir string
+}
+
+// OpenDeadLetters creates dir if needed and returns a store kept in it.
+func OpenDeadLetters(dir string) (*DeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DeadLetterStore{dir: dir}, nil
+}
+
+// Add records job as failed with err.
+func (s *DeadLetterStore) Add(job Job, err error) error {
+	if job.ID == "" {
+		job.ID = newID()
+	}
+	if err != nil {
+		job.LastError = err.Error()
+	}
+	return writeJSON(s.path(job.ID), DeadLetter{Job: job, FailedAt: time.Now().UTC()})
+}
+
+// List returns all dead letters, oldest first.
+func (s *DeadLetterStore) List() ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := readJSONDir(s.dir, func(b []byte) error {
+		var l DeadLetter
+		if err := json.Unmarshal(b, &l); err != nil {
+			return err
+		}
+		letters = append(letters, l)
+		return nil
+	})
+	sort.Slice(letters, func(i, j int) bool { return letters[i].ID < letters[j].ID })
+	return letters, err
+}
+
+// Get returns the dead letter with the given ID.
+func (s *DeadLetterStore) Get(id string) (DeadLetter, error) {
+	var l DeadLetter
+	if !validID(id) {
+		return l, ErrNotFound
+	}
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return l, ErrNotFound
+	}
+	if err != nil {
+		return l, err
+	}
+	err = json.Unmarshal(b, &l)
+	return l, err
+}
+
+// Delete removes the dead letter with the given ID.
+func (s *DeadLetterStore) Delete(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Purge removes every dead letter and returns how many were removed.
+func (s *DeadLetterStore) Purge() (int, error) {
+	letters, err := s.List()
+	n := 0
+	for _, l := range letters {
+		if rmErr := os.Remove(s.path(l.ID)); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			err = errors.Join(err, rmErr)
+			continue
+		}
+		n++
+	}
+	return n, err
+}
+
+func (s *DeadLetterStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// validID rejects IDs that could escape the store directory.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	store, err := OpenDeadLetters(t.TempDir())
+	require.NoError(t, err)
+
+	a, b := testJob("a"), testJob("b")
+	a.ID, b.ID = "0001", "0002"
+	a.Attempts = 5
+	require.NoError(t, store.Add(a, errors.New("discord down")))
+	require.NoError(t, store.Add(b, nil))
+
+	letters, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	require.Equal(t, "0001", letters[0].ID)
+
+	l, err := store.Get("0001")
+	require.NoError(t, err)
+	require.Equal(t, "discord down", l.LastError)
+	require.Equal(t, 5, l.Attempts)
+	require.Equal(t, "a", l.Destination.Name)
+	require.JSONEq(t, `{"issue":{"key":"PRJ-1"}}`, string(l.Payload))
+	require.False(t, l.FailedAt.IsZero())
+
+	_, err = store.Get("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Get("../0001")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.Delete("0001"))
+	require.ErrorIs(t, store.Delete("0001"), ErrNotFound)
+
+	n, err := store.Purge()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	letters, err = store.List()
+	require.NoError(t, err)
+	require.Empty(t, letters)
+}
+
+func TestQueueDeadLettersExhaustedJobs(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	store, err := OpenDeadLetters(t.TempDir())
+	require.NoError(t, err)
+	q := New(spool, func(j Job) error {
+		return errors.New("discord down")
+	}, Options{Size: 10, Workers: 1, MaxAttempts: 2, RetryDelay: time.Millisecond, DeadLetters: store})
+	require.NoError(t, q.Start())
+	defer q.Stop()
+
+	require.NoError(t, q.Enqueue(testJob("a")))
+	waitFor(t, func() bool { return q.Len() == 0 })
+
+	letters, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	require.Equal(t, 2, letters[0].Attempts)
+	require.Equal(t, "discord down", letters[0].LastError)
+}
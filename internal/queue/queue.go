@@ -0,0 +1,309 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/jira"
+	"jira-discord-webhook/internal/metrics"
+	"jira-discord-webhook/internal/routing"
+)
+
+// ErrFull is returned by Enqueue when the queue has no free capacity.
+var ErrFull = errors.New("delivery queue is full")
+
+// Job is a rendered notification waiting to be delivered to one destination.
+type Job struct {
+	ID          string                 `json:"id"`
+	Destination routing.Destination    `json:"destination"`
+	IssueKey    string                 `json:"issueKey,omitempty"`
+	Summary     string                 `json:"summary,omitempty"`
+	Event       string                 `json:"event,omitempty"`
+	Message     discord.WebhookMessage `json:"message"`
+	// Attachments are the Jira files referenced by the message, downloaded
+	// and uploaded when the job is delivered.
+	Attachments []jira.Attachment `json:"attachments,omitempty"`
+	// Payload is the original Jira request body.
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// SendFunc delivers a job. A non-nil error schedules a retry.
+type SendFunc func(Job) error
+
+// Options tunes queue capacity and retry behaviour.
+type Options struct {
+	// Size is the maximum number of jobs waiting for a worker.
+	Size int
+	// Workers is the number of concurrent deliveries.
+	Workers int
+	// MaxAttempts is how many times a job is tried before it is dropped.
+	MaxAttempts int
+	// RetryDelay is the wait between attempts of a failed job.
+	RetryDelay time.Duration
+	// DeadLetters, when set, receives jobs that exhausted MaxAttempts.
+	DeadLetters *DeadLetterStore
+}
+
+// Queue is a bounded worker pool backed by a Spool. Jobs are written to the
+// spool before Enqueue returns and removed only once delivered, so pending
+// notifications are resumed by Start after a restart.
+type Queue struct {
+	spool *Spool
+	send  SendFunc
+	opts  Options
+
+	jobs     chan Job
+	quit     chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+	retries  sync.WaitGroup
+	// pending counts jobs that are queued, in flight or waiting to retry.
+	mu      sync.Mutex
+	pending int
+}
+
+// New returns a queue that delivers jobs with send. Call Start to begin
+// processing.
+func New(spool *Spool, send SendFunc, opts Options) *Queue {
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	return &Queue{
+		spool: spool,
+		send:  send,
+		opts:  opts,
+		jobs:  make(chan Job, opts.Size),
+		quit:  make(chan struct{}),
+	}
+}
+
+// Start resumes jobs left in the spool and starts the workers.
+func (q *Queue) Start() error {
+	jobs, err := q.spool.Load()
+	if err != nil {
+		zap.L().Error("failed to load some spooled jobs", zap.Error(err))
+	}
+	for i := 0; i < q.opts.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	if len(jobs) > 0 {
+		zap.L().Info("resuming spooled deliveries", zap.Int("count", len(jobs)))
+		q.addPending(len(jobs))
+		q.retries.Add(1)
+		go func() {
+			defer q.retries.Done()
+			for _, job := range jobs {
+				if !q.push(job) {
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Enqueue persists job and schedules it for delivery. It returns ErrFull
+// without persisting anything when the queue is at capacity.
+func (q *Queue) Enqueue(job Job) error {
+	q.mu.Lock()
+	if q.pending >= q.opts.Size {
+		q.mu.Unlock()
+		return ErrFull
+	}
+	q.pending++
+	metrics.QueueDepth.Set(float64(q.pending))
+	q.mu.Unlock()
+
+	if job.ID == "" {
+		job.ID = newID()
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+	if err := q.spool.Put(job); err != nil {
+		q.addPending(-1)
+		return fmt.Errorf("spool job: %w", err)
+	}
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		// Resumed or retried jobs occupy the channel; hand off without
+		// blocking the caller. The job is already durable.
+		q.retries.Add(1)
+		go func() {
+			defer q.retries.Done()
+			q.push(job)
+		}()
+		return nil
+	}
+}
+
+// Len returns the number of jobs queued, in flight or waiting to retry.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Saturated reports whether the queue is at capacity, so that Enqueue
+// would return ErrFull.
+func (q *Queue) Saturated() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending >= q.opts.Size
+}
+
+// Spool returns the spool the queue persists jobs in.
+func (q *Queue) Spool() *Spool {
+	return q.spool
+}
+
+// Stop stops the workers after their current delivery. Jobs that have not
+// been delivered remain in the spool.
+func (q *Queue) Stop() {
+	q.Shutdown(context.Background())
+}
+
+// Shutdown stops the workers from taking further jobs and waits until the
+// deliveries in progress finish or ctx is done, in which case it returns
+// ctx.Err(). Jobs that have not been delivered remain in the spool and are
+// resumed by Start after a restart. Shutdown may be called again, e.g.
+// after aborting the deliveries still running at a deadline.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.quit) })
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		q.retries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopping reports whether Shutdown has been called.
+func (q *Queue) stopping() bool {
+	select {
+	case <-q.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *Queue) push(job Job) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	case <-q.quit:
+		return false
+	}
+}
+
+func (q *Queue) addPending(n int) {
+	q.mu.Lock()
+	q.pending += n
+	metrics.QueueDepth.Set(float64(q.pending))
+	q.mu.Unlock()
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for !q.stopping() {
+		select {
+		case <-q.quit:
+			return
+		case job := <-q.jobs:
+			q.deliver(job)
+		}
+	}
+}
+
+func (q *Queue) deliver(job Job) {
+	job.Attempts++
+	// Redacted before the error is logged or stored with the job, as
+	// transport errors carry the webhook URL and its token.
+	err := discord.RedactError(q.send(job))
+	if err == nil {
+		metrics.Delivered(job.Destination.Name, job.CreatedAt)
+		if err := q.spool.Remove(job.ID); err != nil {
+			zap.L().Error("failed to remove delivered job from spool", zap.String("job", job.ID), zap.Error(err))
+		}
+		q.addPending(-1)
+		return
+	}
+	if q.stopping() {
+		// Most likely aborted by the shutdown; the attempt does not count
+		// and the job stays spooled for the next start.
+		zap.L().Warn("Discord delivery interrupted by shutdown",
+			zap.String("job", job.ID), zap.String("destination", job.Destination.Name), zap.Error(err))
+		return
+	}
+	job.LastError = err.Error()
+	if job.Attempts >= q.opts.MaxAttempts {
+		zap.L().Error("giving up on Discord delivery",
+			zap.String("job", job.ID),
+			zap.String("destination", job.Destination.Name),
+			zap.Int("attempts", job.Attempts),
+			zap.Error(err))
+		metrics.Deliveries.WithLabelValues(job.Destination.Name, "dead_letter").Inc()
+		if q.opts.DeadLetters != nil {
+			if dlErr := q.opts.DeadLetters.Add(job, err); dlErr != nil {
+				zap.L().Error("failed to store dead letter", zap.String("job", job.ID), zap.Error(dlErr))
+			}
+		}
+		if err := q.spool.Remove(job.ID); err != nil {
+			zap.L().Error("failed to remove job from spool", zap.String("job", job.ID), zap.Error(err))
+		}
+		q.addPending(-1)
+		return
+	}
+	metrics.Deliveries.WithLabelValues(job.Destination.Name, "retry").Inc()
+	zap.L().Warn("Discord delivery failed, will retry",
+		zap.String("job", job.ID),
+		zap.String("destination", job.Destination.Name),
+		zap.Int("attempt", job.Attempts),
+		zap.Error(err))
+	if err := q.spool.Put(job); err != nil {
+		zap.L().Error("failed to update spooled job", zap.String("job", job.ID), zap.Error(err))
+	}
+	q.retries.Add(1)
+	go func() {
+		defer q.retries.Done()
+		t := time.NewTimer(q.opts.RetryDelay)
+		defer t.Stop()
+		select {
+		case <-q.quit:
+		case <-t.C:
+			q.push(job)
+		}
+	}()
+}
+
+// newID returns a unique ID that sorts in creation order.
+func newID() string {
+	return fmt.Sprintf("%016x%08x", time.Now().UnixNano(), rand.Uint32())
+}
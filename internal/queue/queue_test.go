@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/routing"
+)
+
+func testJob(name string) Job {
+	return Job{
+		Destination: routing.Destination{Name: name, URL: "https://discord.example.com/" + name},
+		Message:     discord.WebhookMessage{Username: "Jira"},
+		Payload:     []byte(`{"issue":{"key":"PRJ-1"}}`),
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueDeliversAndClearsSpool(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var got []string
+	q := New(spool, func(j Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, j.Destination.Name)
+		return nil
+	}, Options{Size: 10, Workers: 1, MaxAttempts: 3})
+	require.NoError(t, q.Start())
+	defer q.Stop()
+
+	require.NoError(t, q.Enqueue(testJob("a")))
+	require.NoError(t, q.Enqueue(testJob("b")))
+	waitFor(t, func() bool { return q.Len() == 0 })
+
+	mu.Lock()
+	require.Equal(t, []string{"a", "b"}, got)
+	mu.Unlock()
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+}
+
+func TestQueueRetriesFailedJobs(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	var mu sync.Mutex
+	attempts := 0
+	q := New(spool, func(j Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if j.Attempts < 3 {
+			return errors.New("discord down")
+		}
+		return nil
+	}, Options{Size: 10, Workers: 1, MaxAttempts: 5, RetryDelay: time.Millisecond})
+	require.NoError(t, q.Start())
+	defer q.Stop()
+
+	require.NoError(t, q.Enqueue(testJob("a")))
+	waitFor(t, func() bool { return q.Len() == 0 })
+	mu.Lock()
+	require.Equal(t, 3, attempts)
+	mu.Unlock()
+}
+
+func TestQueueDropsAfterMaxAttempts(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	q := New(spool, func(j Job) error {
+		return errors.New("discord down")
+	}, Options{Size: 10, Workers: 1, MaxAttempts: 2, RetryDelay: time.Millisecond})
+	require.NoError(t, q.Start())
+	defer q.Stop()
+
+	require.NoError(t, q.Enqueue(testJob("a")))
+	waitFor(t, func() bool { return q.Len() == 0 })
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+}
+
+func TestQueueFull(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	// Not started: nothing drains the queue.
+	q := New(spool, func(j Job) error { return nil }, Options{Size: 1})
+	require.NoError(t, q.Enqueue(testJob("a")))
+	require.ErrorIs(t, q.Enqueue(testJob("b")), ErrFull)
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+}
+
+func TestQueueResumesSpooledJobs(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir)
+	require.NoError(t, err)
+	first := New(spool, func(j Job) error { return nil }, Options{Size: 10})
+	require.NoError(t, first.Enqueue(testJob("a")))
+	require.NoError(t, first.Enqueue(testJob("b")))
+
+	// Simulate a restart with a fresh queue over the same directory.
+	spool, err = OpenSpool(dir)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var got []Job
+	q := New(spool, func(j Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, j)
+		return nil
+	}, Options{Size: 10, Workers: 1})
+	require.NoError(t, q.Start())
+	defer q.Stop()
+	waitFor(t, func() bool { return q.Len() == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, got, 2)
+	require.Equal(t, "a", got[0].Destination.Name)
+	require.Equal(t, "b", got[1].Destination.Name)
+	require.JSONEq(t, `{"issue":{"key":"PRJ-1"}}`, string(got[0].Payload))
+	require.Equal(t, "Jira", got[0].Message.Username)
+}
+
+func TestQueueShutdownDeadlineKeepsJobSpooled(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	dead, err := OpenDeadLetters(t.TempDir())
+	require.NoError(t, err)
+	started, release := make(chan struct{}), make(chan struct{})
+	q := New(spool, func(j Job) error {
+		close(started)
+		<-release
+		return errors.New("context canceled")
+	}, Options{Size: 10, Workers: 1, MaxAttempts: 1, DeadLetters: dead})
+	require.NoError(t, q.Start())
+	require.NoError(t, q.Enqueue(testJob("a")))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.Shutdown(ctx), context.DeadlineExceeded)
+
+	// The aborted delivery neither counts as an attempt nor dead-letters.
+	close(release)
+	require.NoError(t, q.Shutdown(context.Background()))
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Zero(t, jobs[0].Attempts)
+	letters, err := dead.List()
+	require.NoError(t, err)
+	require.Empty(t, letters)
+}
+
+func TestQueueShutdownWaitsForDelivery(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	require.NoError(t, err)
+	started := make(chan struct{})
+	q := New(spool, func(j Job) error {
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, Options{Size: 10, Workers: 1, MaxAttempts: 1})
+	require.NoError(t, q.Start())
+	require.NoError(t, q.Enqueue(testJob("a")))
+	<-started
+
+	require.NoError(t, q.Shutdown(context.Background()))
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+}
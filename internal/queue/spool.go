@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Spool persists pending jobs as one JSON file per job so that they survive
+// a restart. Files are written to a temporary name and renamed into place,
+// so a crash never leaves a partially written job behind.
+type Spool struct {
+	dir string
+}
+
+// OpenSpool creates dir if needed and returns a spool stored in it.
+func OpenSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Spool{dir: dir}, nil
+}
+
+// Dir returns the directory the spool is stored in.
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// CheckWritable verifies that files can be created in the spool directory.
+func (s *Spool) CheckWritable() error {
+	f, err := os.CreateTemp(s.dir, ".probe-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Put writes job to disk, replacing any previous version.
+func (s *Spool) Put(job Job) error {
+	return writeJSON(s.path(job.ID), job)
+}
+
+// Remove deletes the job with the given ID. Missing jobs are ignored.
+func (s *Spool) Remove(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Load returns every spooled job in the order they were created. Files that
+// cannot be decoded are skipped and reported in the returned error.
+func (s *Spool) Load() ([]Job, error) {
+	var jobs []Job
+	err := readJSONDir(s.dir, func(b []byte) error {
+		var job Job
+		if err := json.Unmarshal(b, &job); err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+		return nil
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, err
+}
+
+func (s *Spool) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// writeJSON atomically replaces path with the JSON encoding of v.
+func writeJSON(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readJSONDir calls decode with the contents of every .json file in dir.
+// Unreadable or undecodable files are skipped and reported together.
+func readJSONDir(dir string, decode func([]byte) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := decode(b); err != nil {
+			errs = append(errs, errors.New(name+": "+err.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
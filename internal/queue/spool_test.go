@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolPutLoadRemove(t *testing.T) {
+	spool, err := OpenSpool(filepath.Join(t.TempDir(), "nested", "spool"))
+	require.NoError(t, err)
+
+	a, b := testJob("a"), testJob("b")
+	a.ID, b.ID = "0002", "0001"
+	require.NoError(t, spool.Put(a))
+	require.NoError(t, spool.Put(b))
+
+	jobs, err := spool.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, "0001", jobs[0].ID, "jobs should be ordered by id")
+
+	a.Attempts = 2
+	require.NoError(t, spool.Put(a))
+	require.NoError(t, spool.Remove(b.ID))
+	require.NoError(t, spool.Remove("missing"))
+
+	jobs, err = spool.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, 2, jobs[0].Attempts)
+}
+
+func TestSpoolLoadSkipsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir)
+	require.NoError(t, err)
+	require.NoError(t, spool.Put(testJob("a")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("partial"), 0o644))
+
+	jobs, err := spool.Load()
+	require.Error(t, err)
+	require.Len(t, jobs, 1)
+}
@@ -0,0 +1,259 @@
+// Package reload re-reads configuration files while the service runs.
+package reload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// LoadFunc reads the configuration at path and, when it is valid, makes it
+// active. On error the previous configuration must stay active.
+type LoadFunc func(path string) error
+
+// GroupFunc reads the configuration spread over a group of files and, when
+// it is valid as a whole, makes all of it active. On error the previous
+// configuration must stay active.
+type GroupFunc func() error
+
+// file is a registered file, or a group of files loaded together.
+type file struct {
+	name  string
+	paths []string
+	load  GroupFunc
+}
+
+// Watcher reloads registered files when they change on disk or the process
+// receives SIGHUP. Files are reloaded in the order they were added. Files
+// that refer to each other (e.g. templates used by routes) belong in one
+// group, so that a change spanning them is applied in a single reload.
+type Watcher struct {
+	// Delay collects the burst of events an editor or a Kubernetes
+	// ConfigMap update produces into one reload.
+	Delay time.Duration
+
+	mu    sync.Mutex
+	files []file
+	// sums holds the SHA-256 of each file's last successfully loaded
+	// content, by path.
+	sums map[string]string
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New returns a watcher with no files. Call Start to begin watching.
+func New() *Watcher {
+	return &Watcher{Delay: 250 * time.Millisecond}
+}
+
+// Add registers the file at path, described by name in logs, to be
+// reloaded with load.
+func (w *Watcher) Add(name, path string, load LoadFunc) {
+	w.AddGroup(name, []string{path}, singleFile(path, load))
+}
+
+// Load loads the file at path with load and registers it like Add. Unlike
+// a reload, a failure is returned so that startup can abort.
+func (w *Watcher) Load(name, path string, load LoadFunc) error {
+	return w.LoadGroup(name, []string{path}, singleFile(path, load))
+}
+
+// AddGroup registers the files at paths, described by name in logs, to be
+// reloaded together with load whenever any of them changes.
+func (w *Watcher) AddGroup(name string, paths []string, load GroupFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = append(w.files, file{name: name, paths: paths, load: load})
+}
+
+// LoadGroup loads the files at paths with load and registers them like
+// AddGroup. A failure is returned so that startup can abort.
+func (w *Watcher) LoadGroup(name string, paths []string, load GroupFunc) error {
+	f := file{name: name, paths: paths, load: load}
+	if err := w.load(f); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.files = append(w.files, f)
+	w.mu.Unlock()
+	return nil
+}
+
+// Checksum identifies the configuration in effect: the SHA-256 of the
+// contents last loaded successfully from every registered file.
+func (w *Watcher) Checksum() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	h := sha256.New()
+	for _, f := range w.files {
+		for _, path := range f.paths {
+			fmt.Fprintf(h, "%s\x00%s\n", f.name, w.sums[path])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Reload reloads every registered file and returns the number that failed.
+// Failures are logged and leave the previous configuration active.
+func (w *Watcher) Reload() int {
+	w.mu.Lock()
+	files := append([]file(nil), w.files...)
+	w.mu.Unlock()
+	failed := 0
+	for _, f := range files {
+		if !w.reloadFile(f) {
+			failed++
+		}
+	}
+	return failed
+}
+
+func singleFile(path string, load LoadFunc) GroupFunc {
+	return func() error { return load(path) }
+}
+
+// load calls f.load and records the checksums of the content it loaded.
+func (w *Watcher) load(f file) error {
+	sums := make(map[string]string, len(f.paths))
+	for _, path := range f.paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		sums[path] = hex.EncodeToString(sum[:])
+	}
+	if err := f.load(); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sums == nil {
+		w.sums = make(map[string]string)
+	}
+	for path, sum := range sums {
+		w.sums[path] = sum
+	}
+	return nil
+}
+
+func (w *Watcher) reloadFile(f file) bool {
+	path := strings.Join(f.paths, ", ")
+	if err := w.load(f); err != nil {
+		zap.L().Error("failed to reload config; keeping previous version",
+			zap.String("config", f.name), zap.String("path", path), zap.Error(err))
+		return false
+	}
+	zap.L().Info("config reloaded", zap.String("config", f.name), zap.String("path", path))
+	return true
+}
+
+// Start watches the directories of the registered files and listens for
+// SIGHUP. Directories are watched rather than the files so that editors
+// replacing a file by rename, and ConfigMap symlink swaps, are seen.
+func (w *Watcher) Start() error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]bool{}
+	w.mu.Lock()
+	for _, f := range w.files {
+		for _, path := range f.paths {
+			dir := filepath.Dir(path)
+			if dirs[dir] {
+				continue
+			}
+			if err := fw.Add(dir); err != nil {
+				w.mu.Unlock()
+				fw.Close()
+				return err
+			}
+			dirs[dir] = true
+		}
+	}
+	w.quit, w.done = make(chan struct{}), make(chan struct{})
+	w.mu.Unlock()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go w.run(fw, hup, w.quit, w.done)
+	return nil
+}
+
+// Stop ends watching. It is safe to call on a watcher that was not started.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	quit, done := w.quit, w.done
+	w.quit = nil
+	w.mu.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+func (w *Watcher) run(fw *fsnotify.Watcher, hup chan os.Signal, quit, done chan struct{}) {
+	defer close(done)
+	defer fw.Close()
+	defer signal.Stop(hup)
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	changed := map[string]bool{}
+	for {
+		select {
+		case <-quit:
+			timer.Stop()
+			return
+		case <-hup:
+			zap.L().Info("SIGHUP received; reloading config")
+			w.Reload()
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			changed[filepath.Clean(ev.Name)] = true
+			timer.Reset(w.Delay)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			zap.L().Warn("config watcher error", zap.Error(err))
+		case <-timer.C:
+			w.reloadChanged(changed)
+			changed = map[string]bool{}
+		}
+	}
+}
+
+// reloadChanged reloads the files among changed, and the groups with a
+// file among them. Files next to a changed "..data" entry are reloaded too,
+// because a ConfigMap update only swaps that symlink.
+func (w *Watcher) reloadChanged(changed map[string]bool) {
+	w.mu.Lock()
+	files := append([]file(nil), w.files...)
+	w.mu.Unlock()
+	for _, f := range files {
+		for _, path := range f.paths {
+			if changed[filepath.Clean(path)] || changed[filepath.Join(filepath.Dir(path), "..data")] {
+				w.reloadFile(f)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package reload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// valueLoader keeps the last valid content of a file, rejecting "bad".
+type valueLoader struct {
+	value atomic.Value
+	loads atomic.Int32
+}
+
+func (l *valueLoader) load(path string) error {
+	l.loads.Add(1)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if string(b) == "bad" {
+		return errors.New("invalid config")
+	}
+	l.value.Store(string(b))
+	return nil
+}
+
+func (l *valueLoader) waitFor(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if v, _ := l.value.Load().(string); v == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("value %q was not loaded, have %v", want, l.value.Load())
+}
+
+func startWatcher(t *testing.T, l *valueLoader) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.load(path); err != nil {
+		t.Fatal(err)
+	}
+	w := New()
+	w.Delay = 10 * time.Millisecond
+	w.Add("test", path, l.load)
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Stop)
+	return path
+}
+
+func TestWatcherReloadsChangedFile(t *testing.T) {
+	l := &valueLoader{}
+	path := startWatcher(t, l)
+
+	if err := os.WriteFile(path, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l.waitFor(t, "two")
+
+	// Replacing the file by rename, as editors do, is seen too.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("three"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	l.waitFor(t, "three")
+}
+
+func TestWatcherKeepsPreviousOnError(t *testing.T) {
+	l := &valueLoader{}
+	path := startWatcher(t, l)
+
+	before := l.loads.Load()
+	if err := os.WriteFile(path, []byte("bad"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for l.loads.Load() == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := l.value.Load(); v != "one" {
+		t.Fatalf("invalid config replaced the previous one: %v", v)
+	}
+}
+
+func TestWatcherReloadsOnSIGHUP(t *testing.T) {
+	l := &valueLoader{}
+	path := startWatcher(t, l)
+	// The file is unchanged, so only the signal reloads it.
+	l.value.Store("stale")
+	before := l.loads.Load()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	l.waitFor(t, "one")
+	if l.loads.Load() == before {
+		t.Fatalf("%s was not reloaded", path)
+	}
+}
+
+func TestReloadCountsFailures(t *testing.T) {
+	dir := t.TempDir()
+	good, bad := filepath.Join(dir, "good"), filepath.Join(dir, "bad")
+	os.WriteFile(good, []byte("ok"), 0o644)
+	os.WriteFile(bad, []byte("bad"), 0o644)
+	l := &valueLoader{}
+	w := New()
+	w.Add("good", good, l.load)
+	w.Add("bad", bad, l.load)
+	if n := w.Reload(); n != 1 {
+		t.Fatalf("expected 1 failure, got %d", n)
+	}
+	if v := l.value.Load(); v != "ok" {
+		t.Fatalf("unexpected value %v", v)
+	}
+}
+
+func TestWatcherReloadsGroupTogether(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	os.WriteFile(a, []byte("one"), 0o644)
+	os.WriteFile(b, []byte("one"), 0o644)
+	// The group is only valid when both files agree, like routes naming
+	// templates.
+	l := &valueLoader{}
+	load := func() error {
+		va, _ := os.ReadFile(a)
+		vb, _ := os.ReadFile(b)
+		if string(va) != string(vb) {
+			return errors.New("files disagree")
+		}
+		l.value.Store(string(va))
+		return nil
+	}
+	w := New()
+	w.Delay = 10 * time.Millisecond
+	if err := w.LoadGroup("pair", []string{a, b}, load); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Stop)
+
+	// Whether or not the writes land in one reload, the group ends up
+	// loaded from both new files.
+	if err := os.WriteFile(a, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v := l.value.Load(); v != "one" {
+		t.Fatalf("inconsistent group was loaded: %v", v)
+	}
+	if err := os.WriteFile(b, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l.waitFor(t, "two")
+}
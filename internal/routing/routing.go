@@ -0,0 +1,267 @@
+package routing
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"jira-discord-webhook/internal/discord"
+	"jira-discord-webhook/internal/jira"
+)
+
+// Delivery modes for a destination.
+const (
+	// ModePost posts a new message for every event.
+	ModePost = "post"
+	// ModeEdit posts one message per issue and edits it on later events.
+	ModeEdit = "edit"
+	// ModeThread creates a forum post per issue and posts later events
+	// into it.
+	ModeThread = "thread"
+)
+
+// Destination is a named Discord webhook that events can be routed to.
+type Destination struct {
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+	// Mode is ModePost (the default), ModeEdit or ModeThread.
+	Mode string `yaml:"mode" json:"mode,omitempty"`
+	// ThreadID sends every message into an existing thread.
+	ThreadID string `yaml:"thread_id" json:"threadId,omitempty"`
+	// Template names the message template used for this destination.
+	Template string `yaml:"template" json:"template,omitempty"`
+	// TableStyle is how tables in descriptions and comments are rendered:
+	// code (the default), list or markdown.
+	TableStyle jira.TableStyle `yaml:"table_style" json:"tableStyle,omitempty"`
+}
+
+// Match lists the Jira values a route applies to. Empty lists match any
+// value and comparisons are case-insensitive. Labels and components match
+// when the issue has at least one of the listed values.
+type Match struct {
+	Projects   []string `yaml:"projects"`
+	IssueTypes []string `yaml:"issue_types"`
+	Priorities []string `yaml:"priorities"`
+	Statuses   []string `yaml:"statuses"`
+	Labels     []string `yaml:"labels"`
+	Components []string `yaml:"components"`
+}
+
+// Route sends events matching Match to the named destinations.
+type Route struct {
+	Name         string   `yaml:"name"`
+	Match        Match    `yaml:"match"`
+	Destinations []string `yaml:"destinations"`
+	// Template, when set, overrides the destinations' message template
+	// for events matched by this route.
+	Template string `yaml:"template"`
+	// TableStyle, when set, overrides the destinations' table style for
+	// events matched by this route.
+	TableStyle jira.TableStyle `yaml:"table_style"`
+}
+
+// Config is the YAML routing configuration.
+type Config struct {
+	Destinations []Destination `yaml:"destinations"`
+	Routes       []Route       `yaml:"routes"`
+	Default      []string      `yaml:"default"`
+}
+
+// Router resolves Jira webhooks to Discord destinations.
+type Router struct {
+	cfg          Config
+	destinations map[string]Destination
+}
+
+// Load reads and validates the routing configuration at path.
+func Load(path string) (*Router, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse validates a YAML routing configuration. Destination URLs may
+// reference environment variables, e.g. ${DISCORD_WEBHOOK_URL}.
+func Parse(b []byte) (*Router, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// New validates cfg and returns a router for it.
+func New(cfg Config) (*Router, error) {
+	r := &Router{destinations: make(map[string]Destination)}
+	for i, d := range cfg.Destinations {
+		if d.Name == "" {
+			return nil, fmt.Errorf("destination %d: name is required", i)
+		}
+		if _, ok := r.destinations[d.Name]; ok {
+			return nil, fmt.Errorf("destination %q: duplicate name", d.Name)
+		}
+		d.URL = os.ExpandEnv(d.URL)
+		if u, err := url.Parse(d.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("destination %q: invalid url", d.Name)
+		}
+		switch d.Mode {
+		case "", ModePost, ModeEdit, ModeThread:
+		default:
+			return nil, fmt.Errorf("destination %q: unknown mode %q", d.Name, d.Mode)
+		}
+		style, err := tableStyle(d.TableStyle)
+		if err != nil {
+			return nil, fmt.Errorf("destination %q: %w", d.Name, err)
+		}
+		d.TableStyle = style
+		if d.ThreadID != "" {
+			if d.Mode == ModeThread {
+				return nil, fmt.Errorf("destination %q: thread_id cannot be combined with thread mode", d.Name)
+			}
+			d.URL = discord.WithQuery(d.URL, "thread_id", d.ThreadID)
+		}
+		cfg.Destinations[i] = d
+		r.destinations[d.Name] = d
+	}
+	for i, rt := range cfg.Routes {
+		if len(rt.Destinations) == 0 {
+			return nil, fmt.Errorf("route %d (%s): no destinations", i, rt.Name)
+		}
+		for _, name := range rt.Destinations {
+			if _, ok := r.destinations[name]; !ok {
+				return nil, fmt.Errorf("route %d (%s): unknown destination %q", i, rt.Name, name)
+			}
+		}
+		style, err := tableStyle(rt.TableStyle)
+		if err != nil {
+			return nil, fmt.Errorf("route %d (%s): %w", i, rt.Name, err)
+		}
+		cfg.Routes[i].TableStyle = style
+	}
+	for _, name := range cfg.Default {
+		if _, ok := r.destinations[name]; !ok {
+			return nil, fmt.Errorf("default: unknown destination %q", name)
+		}
+	}
+	r.cfg = cfg
+	return r, nil
+}
+
+// Templates returns the names of all message templates referenced by
+// destinations and routes.
+func (r *Router) Templates() []string {
+	var names []string
+	for _, d := range r.cfg.Destinations {
+		if d.Template != "" {
+			names = append(names, d.Template)
+		}
+	}
+	for _, rt := range r.cfg.Routes {
+		if rt.Template != "" {
+			names = append(names, rt.Template)
+		}
+	}
+	return names
+}
+
+// Destinations returns every destination whose route matches w, in
+// configuration order and without duplicates. When no route matches the
+// default destinations are returned. A destination reached through a route
+// with a template or table style uses the first such route's setting.
+func (r *Router) Destinations(w jira.Webhook) []Destination {
+	var names []string
+	// routes[i] is the route names[i] was reached through.
+	var routes []*Route
+	for i, rt := range r.cfg.Routes {
+		if rt.Match.matches(w) {
+			for _, name := range rt.Destinations {
+				names = append(names, name)
+				routes = append(routes, &r.cfg.Routes[i])
+			}
+		}
+	}
+	if len(names) == 0 {
+		names = r.cfg.Default
+		routes = make([]*Route, len(names))
+	}
+	index := make(map[string]int, len(names))
+	templated := make(map[string]bool)
+	styled := make(map[string]bool)
+	dests := make([]Destination, 0, len(names))
+	for i, name := range names {
+		j, ok := index[name]
+		if !ok {
+			j = len(dests)
+			index[name] = j
+			dests = append(dests, r.destinations[name])
+		}
+		rt := routes[i]
+		if rt == nil {
+			continue
+		}
+		if rt.Template != "" && !templated[name] {
+			dests[j].Template = rt.Template
+			templated[name] = true
+		}
+		if rt.TableStyle != "" && !styled[name] {
+			dests[j].TableStyle = rt.TableStyle
+			styled[name] = true
+		}
+	}
+	return dests
+}
+
+// tableStyle validates a configured table style, keeping it empty when
+// unset so that routes only override styles they name.
+func tableStyle(s jira.TableStyle) (jira.TableStyle, error) {
+	if s == "" {
+		return "", nil
+	}
+	return jira.ParseTableStyle(string(s))
+}
+
+func (m Match) matches(w jira.Webhook) bool {
+	f := w.Issue.Fields
+	var components []string
+	for _, c := range f.Components {
+		components = append(components, c.Name)
+	}
+	return matchOne(m.Projects, f.Project.Key) &&
+		matchOne(m.IssueTypes, f.Issuetype.Name) &&
+		matchOne(m.Priorities, f.Priority.Name) &&
+		matchOne(m.Statuses, f.Status.Name) &&
+		matchAny(m.Labels, f.Labels) &&
+		matchAny(m.Components, components)
+}
+
+// matchOne reports whether v is in want. An empty want matches anything.
+func matchOne(want []string, v string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		if strings.EqualFold(w, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether any of have is in want. An empty want matches
+// anything.
+func matchAny(want, have []string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, h := range have {
+		if matchOne(want, h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"jira-discord-webhook/internal/jira"
+)
+
+const testConfig = `destinations:
+  - name: general
+    url: ${TEST_GENERAL_WEBHOOK}
+  - name: backend
+    url: https://discord.example.com/api/webhooks/1/backend
+  - name: incidents
+    url: https://discord.example.com/api/webhooks/2/incidents
+routes:
+  - name: backend-bugs
+    match:
+      projects: [BE]
+      issue_types: [bug]
+    destinations: [backend]
+  - name: blockers
+    match:
+      priorities: [Blocker]
+      labels: [incident, outage]
+    destinations: [incidents, backend]
+default: [general]
+`
+
+func webhook(project, issueType, priority string, labels ...string) jira.Webhook {
+	var w jira.Webhook
+	w.Issue.Key = project + "-1"
+	w.Issue.Fields.Project.Key = project
+	w.Issue.Fields.Issuetype.Name = issueType
+	w.Issue.Fields.Priority.Name = priority
+	w.Issue.Fields.Labels = labels
+	return w
+}
+
+func names(dests []Destination) []string {
+	var out []string
+	for _, d := range dests {
+		out = append(out, d.Name)
+	}
+	return out
+}
+
+func TestDestinations(t *testing.T) {
+	os.Setenv("TEST_GENERAL_WEBHOOK", "https://discord.example.com/api/webhooks/0/general")
+	defer os.Unsetenv("TEST_GENERAL_WEBHOOK")
+	r, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		name string
+		w    jira.Webhook
+		want []string
+	}{
+		{"default", webhook("FE", "Task", "Low"), []string{"general"}},
+		{"projectAndType", webhook("BE", "Bug", "Low"), []string{"backend"}},
+		{"typeMismatch", webhook("BE", "Story", "Low"), []string{"general"}},
+		{"labelAndPriority", webhook("FE", "Task", "Blocker", "outage"), []string{"incidents", "backend"}},
+		{"labelMissing", webhook("FE", "Task", "Blocker", "ui"), []string{"general"}},
+		{"multipleRoutesDeduplicated", webhook("BE", "Bug", "Blocker", "incident"), []string{"backend", "incidents"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := names(r.Destinations(tc.w))
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("got %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+	if got := r.Destinations(webhook("FE", "Task", "Low"))[0].URL; got != "https://discord.example.com/api/webhooks/0/general" {
+		t.Errorf("env not expanded in url: %q", got)
+	}
+}
+
+func TestDestinationsComponents(t *testing.T) {
+	r, err := New(Config{
+		Destinations: []Destination{{Name: "api", URL: "https://discord.example.com/api"}},
+		Routes:       []Route{{Name: "api", Match: Match{Components: []string{"API"}}, Destinations: []string{"api"}}},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	w := webhook("BE", "Bug", "Low")
+	if got := r.Destinations(w); len(got) != 0 {
+		t.Fatalf("expected no destinations, got %v", names(got))
+	}
+	w.Issue.Fields.Components = append(w.Issue.Fields.Components, struct {
+		Name string `json:"name"`
+	}{Name: "api"})
+	if got := names(r.Destinations(w)); len(got) != 1 || got[0] != "api" {
+		t.Fatalf("expected api destination, got %v", got)
+	}
+}
+
+func TestDestinationThreadID(t *testing.T) {
+	r, err := Parse([]byte("destinations:\n  - {name: a, url: https://x.example.com/api/webhooks/1/tok, thread_id: \"123\"}\ndefault: [a]\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := r.Destinations(jira.Webhook{})[0].URL; got != "https://x.example.com/api/webhooks/1/tok?thread_id=123" {
+		t.Fatalf("unexpected url: %s", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"missingName":            "destinations:\n  - url: https://x.example.com\n",
+		"duplicateName":          "destinations:\n  - {name: a, url: https://x.example.com}\n  - {name: a, url: https://y.example.com}\n",
+		"badURL":                 "destinations:\n  - {name: a, url: not-a-url}\n",
+		"unknownDestination":     "destinations:\n  - {name: a, url: https://x.example.com}\nroutes:\n  - {name: r, destinations: [b]}\n",
+		"routeNoDestination":     "destinations:\n  - {name: a, url: https://x.example.com}\nroutes:\n  - {name: r}\n",
+		"unknownDefault":         "destinations:\n  - {name: a, url: https://x.example.com}\ndefault: [b]\n",
+		"invalidYAML":            "destinations: [",
+		"threadIDWithThreadMode": "destinations:\n  - {name: a, url: https://x.example.com, mode: thread, thread_id: \"1\"}\n",
+		"unknownMode":            "destinations:\n  - {name: a, url: https://x.example.com, mode: shout}\n",
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(cfg)); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	cfg := "destinations:\n  - {name: a, url: https://x.example.com}\ndefault: [a]\n"
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := r.Destinations(jira.Webhook{}); len(got) != 1 || got[0].Name != "a" {
+		t.Fatalf("unexpected destinations: %+v", got)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestDestinationsTemplate(t *testing.T) {
+	r, err := New(Config{
+		Destinations: []Destination{
+			{Name: "a", URL: "https://discord.example.com/a", Template: "full"},
+			{Name: "b", URL: "https://discord.example.com/b"},
+		},
+		Routes: []Route{
+			{Name: "plain", Match: Match{Projects: []string{"BE"}}, Destinations: []string{"a"}},
+			{Name: "compact", Match: Match{Projects: []string{"BE"}}, Destinations: []string{"a", "b"}, Template: "compact"},
+		},
+		Default: []string{"a"},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	got := r.Destinations(webhook("BE", "Bug", "Low"))
+	if len(got) != 2 || got[0].Template != "compact" || got[1].Template != "compact" {
+		t.Fatalf("unexpected destinations: %+v", got)
+	}
+	if got := r.Destinations(webhook("FE", "Bug", "Low")); got[0].Template != "full" {
+		t.Fatalf("default destination should keep its template, got %q", got[0].Template)
+	}
+	if got := r.Templates(); len(got) != 2 || got[0] != "full" || got[1] != "compact" {
+		t.Fatalf("unexpected templates: %v", got)
+	}
+}
+
+func TestDestinationsTableStyle(t *testing.T) {
+	r, err := New(Config{
+		Destinations: []Destination{
+			{Name: "a", URL: "https://discord.example.com/a", TableStyle: "List"},
+			{Name: "b", URL: "https://discord.example.com/b"},
+		},
+		Routes: []Route{
+			{Name: "wide", Match: Match{Projects: []string{"BE"}}, Destinations: []string{"b"}, TableStyle: "markdown"},
+			{Name: "all", Match: Match{Projects: []string{"BE"}}, Destinations: []string{"a", "b"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	got := r.Destinations(webhook("BE", "Bug", "Low"))
+	if len(got) != 2 || got[0].TableStyle != jira.TableMarkdown || got[1].TableStyle != jira.TableList {
+		t.Fatalf("unexpected destinations: %+v", got)
+	}
+
+	_, err = New(Config{Destinations: []Destination{{Name: "a", URL: "https://discord.example.com/a", TableStyle: "grid"}}})
+	if err == nil || !strings.Contains(err.Error(), "table style") {
+		t.Fatalf("expected table style error, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	MessageID string `json:"messageId"`
+}
+
+func TestStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "messages.json")
+	s, err := Open(path)
+	require.NoError(t, err)
+
+	var r record
+	require.False(t, s.Get("PRJ-1", &r))
+	require.NoError(t, s.Set("PRJ-1", record{MessageID: "42"}))
+	require.NoError(t, s.Set("PRJ-2", record{MessageID: "43"}))
+	require.NoError(t, s.Delete("PRJ-2"))
+	require.NoError(t, s.Delete("missing"))
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, reopened.Len())
+	require.True(t, reopened.Get("PRJ-1", &r))
+	require.Equal(t, "42", r.MessageID)
+}
+
+func TestStoreOpenCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err := Open(path)
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"regexp"
 	"strings"
@@ -18,23 +19,41 @@ type UserMapping struct {
 	JiraToDiscord []JiraUserMapping `yaml:"jira_to_discord"`
 }
 
-var jiraToDiscord UserMapping
-
-func LoadUserMapping(path string) error {
+// LoadUserMapping reads and validates the mapping at path.
+func LoadUserMapping(path string) (*UserMapping, error) {
 	f, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return ParseUserMapping(f)
+}
+
+// ParseUserMapping decodes and validates a YAML user mapping. Every entry
+// needs a Discord ID and an account ID or display name.
+func ParseUserMapping(b []byte) (*UserMapping, error) {
 	var raw UserMapping
-	if err := yaml.Unmarshal(f, &raw); err != nil {
-		return err
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, err
 	}
-	jiraToDiscord = raw
-	return nil
+	for i, u := range raw.JiraToDiscord {
+		if u.DiscordID == "" {
+			return nil, fmt.Errorf("jira_to_discord[%d]: discordId is required", i)
+		}
+		if u.AccountID == "" && u.DisplayName == "" {
+			return nil, fmt.Errorf("jira_to_discord[%d]: accountId or displayName is required", i)
+		}
+	}
+	return &raw, nil
 }
 
-func DiscordMentionForJiraUser(key string) string {
-	for _, u := range jiraToDiscord.JiraToDiscord {
+// Mention returns the Discord mention of the Jira user with the account ID
+// or display name key, or key itself when the user is not mapped. A nil
+// mapping maps nobody.
+func (m *UserMapping) Mention(key string) string {
+	if m == nil {
+		return key
+	}
+	for _, u := range m.JiraToDiscord {
 		if u.AccountID == key || u.DisplayName == key {
 			return "<@" + u.DiscordID + ">"
 		}
@@ -44,12 +63,12 @@ func DiscordMentionForJiraUser(key string) string {
 
 var accountIdPattern = regexp.MustCompile(`\[~accountid:([a-zA-Z0-9:.-]+)\]`)
 
-// ReplaceJiraMentionsWithDiscord replaces all [~accountid:...] in text with Discord mentions.
-func ReplaceJiraMentionsWithDiscord(text string) string {
+// ReplaceMentions replaces all [~accountid:...] in text with Discord mentions.
+func (m *UserMapping) ReplaceMentions(text string) string {
 	return accountIdPattern.ReplaceAllStringFunc(text, func(match string) string {
 		groups := accountIdPattern.FindStringSubmatch(match)
 		if len(groups) == 2 {
-			return DiscordMentionForJiraUser(groups[1])
+			return m.Mention(groups[1])
 		}
 		return match
 	})
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -26,27 +27,28 @@ func TestLoadUserMappingAndDiscordMention(t *testing.T) {
 	tmpFile.Close()
 
 	// Load mapping
-	if err := LoadUserMapping(tmpFile.Name()); err != nil {
+	m, err := LoadUserMapping(tmpFile.Name())
+	if err != nil {
 		t.Fatalf("LoadUserMapping failed: %v", err)
 	}
 
 	// Test by accountId
-	if got := DiscordMentionForJiraUser("accid1"); got != "<@111111111111111111>" {
+	if got := m.Mention("accid1"); got != "<@111111111111111111>" {
 		t.Errorf("expected <@111111111111111111>, got %s", got)
 	}
 	// Test by displayName
-	if got := DiscordMentionForJiraUser("User Two"); got != "<@222222222222222222>" {
+	if got := m.Mention("User Two"); got != "<@222222222222222222>" {
 		t.Errorf("expected <@222222222222222222>, got %s", got)
 	}
 	// Test fallback
-	if got := DiscordMentionForJiraUser("unknown"); got != "unknown" {
+	if got := m.Mention("unknown"); got != "unknown" {
 		t.Errorf("expected unknown, got %s", got)
 	}
 }
 
 func TestLoadUserMapping_ErrorCases(t *testing.T) {
 	// Test file not found
-	err := LoadUserMapping("/nonexistent/path/to/file.yaml")
+	_, err := LoadUserMapping("/nonexistent/path/to/file.yaml")
 	if err == nil {
 		t.Error("expected error for missing file")
 	}
@@ -61,21 +63,21 @@ func TestLoadUserMapping_ErrorCases(t *testing.T) {
 		t.Fatalf("failed to write temp yaml: %v", err)
 	}
 	tmpFile.Close()
-	if err := LoadUserMapping(tmpFile.Name()); err == nil {
+	if _, err := LoadUserMapping(tmpFile.Name()); err == nil {
 		t.Error("expected error for invalid yaml")
 	}
 }
 
-func TestDiscordMentionForJiraUser_EmptyMapping(t *testing.T) {
-	jiraToDiscord = UserMapping{}
-	if got := DiscordMentionForJiraUser("anyone"); got != "anyone" {
+func TestMention_NilMapping(t *testing.T) {
+	var m *UserMapping
+	if got := m.Mention("anyone"); got != "anyone" {
 		t.Errorf("expected fallback to key, got %q", got)
 	}
 }
 
-func TestReplaceJiraMentionsWithDiscord(t *testing.T) {
+func TestReplaceMentions(t *testing.T) {
 	// Setup a fake mapping
-	jiraToDiscord = UserMapping{
+	m := &UserMapping{
 		JiraToDiscord: []JiraUserMapping{
 			{AccountID: "accid1", DisplayName: "User One", DiscordID: "111111111111111111"},
 			{AccountID: "accid2", DisplayName: "User Two", DiscordID: "222222222222222222"},
@@ -85,29 +87,29 @@ func TestReplaceJiraMentionsWithDiscord(t *testing.T) {
 	// Test single accountId mention
 	in := "Hello [~accountid:accid1]!"
 	want := "Hello <@111111111111111111>!"
-	if got := ReplaceJiraMentionsWithDiscord(in); got != want {
+	if got := m.ReplaceMentions(in); got != want {
 		t.Errorf("singleAccountIdMention: got %q, want %q", got, want)
 	}
 
 	// Test multiple accountId mentions
 	in = "[~accountid:accid1] and [~accountid:accid2] are here."
 	want = "<@111111111111111111> and <@222222222222222222> are here."
-	if got := ReplaceJiraMentionsWithDiscord(in); got != want {
+	if got := m.ReplaceMentions(in); got != want {
 		t.Errorf("multipleAccountIdMentions: got %q, want %q", got, want)
 	}
 
 	// Test unknown accountId
 	in = "Hi [~accountid:unknown]!"
 	want = "Hi unknown!" // The current implementation falls back to the key if not found
-	if got := ReplaceJiraMentionsWithDiscord(in); got != want {
+	if got := m.ReplaceMentions(in); got != want {
 		t.Errorf("unknownAccountId: got %q, want %q", got, want)
 	}
 }
 
-func TestReplaceJiraMentionsWithDiscord_NoMentions(t *testing.T) {
-	jiraToDiscord = UserMapping{}
+func TestReplaceMentions_NoMentions(t *testing.T) {
+	var m *UserMapping
 	in := "No mentions here."
-	if got := ReplaceJiraMentionsWithDiscord(in); got != in {
+	if got := m.ReplaceMentions(in); got != in {
 		t.Errorf("expected unchanged, got %q", got)
 	}
 }
@@ -202,3 +204,13 @@ func TestIsInBackticks(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadUserMappingInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.yaml")
+	if err := os.WriteFile(path, []byte("jira_to_discord:\n  - accountId: accid2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := LoadUserMapping(path); err == nil || m != nil {
+		t.Fatalf("expected an error for an entry without discordId, got %v", m)
+	}
+}